@@ -0,0 +1,88 @@
+package tester
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bandwidth is a rate in bits per second.
+type Bandwidth uint
+
+var bandwidthPrefixes = map[string]float64{
+	"":   1,
+	"k":  1e3,
+	"m":  1e6,
+	"g":  1e9,
+	"t":  1e12,
+	"ki": 1 << 10,
+	"mi": 1 << 20,
+	"gi": 1 << 30,
+	"ti": 1 << 40,
+}
+
+// ParseBandwidth parses a rate such as "50mbit", "6.5Mbps", "800kbit", "1gbit" or "12.5MB/s". Units
+// with a lowercase b (bit, bps, b/s) are bits and units with an uppercase B or "byte" are bytes,
+// which is the common usage rather than tc's, where "bps" means bytes per second. A number without
+// a unit is bits per second, and underscores are ignored.
+func ParseBandwidth(s string) (Bandwidth, error) {
+	value := strings.ReplaceAll(strings.TrimSpace(s), "_", "")
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i < 0 {
+		i = len(value)
+	}
+
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q", s)
+	}
+
+	unit := strings.TrimSpace(value[i:])
+	lower := strings.ToLower(unit)
+	isBytes := strings.Contains(lower, "byte") || (strings.Contains(unit, "B") && !strings.Contains(lower, "bit"))
+
+	prefix := strings.TrimSuffix(lower, "/s")
+	if strings.HasSuffix(prefix, "bps") {
+		prefix = strings.TrimSuffix(prefix, "ps")
+	}
+	for _, suffix := range []string{"bytes", "byte", "bits", "bit", "b"} {
+		if strings.HasSuffix(prefix, suffix) {
+			prefix = strings.TrimSuffix(prefix, suffix)
+			break
+		}
+	}
+	multiplier, ok := bandwidthPrefixes[prefix]
+	if !ok {
+		return 0, fmt.Errorf("unknown bandwidth unit %q in %q", unit, s)
+	}
+	if isBytes {
+		multiplier *= 8
+	}
+
+	bitsPerSecond := math.Round(number * multiplier)
+	if bitsPerSecond >= math.MaxInt64 {
+		return 0, fmt.Errorf("bandwidth %q is too large", s)
+	}
+	return Bandwidth(bitsPerSecond), nil
+}
+
+// String formats the bandwidth for tc in the largest unit it reaches, keeping any fraction, e.g.
+// 1500000 -> "1.5mbit" and 2000 -> "2kbit". ParseBandwidth reads it back exactly.
+func (b Bandwidth) String() string {
+	for _, unit := range []struct {
+		name string
+		size Bandwidth
+	}{
+		{"gbit", 1_000_000_000},
+		{"mbit", 1_000_000},
+		{"kbit", 1_000},
+	} {
+		if b >= unit.size {
+			return strconv.FormatFloat(float64(b)/float64(unit.size), 'f', -1, 64) + unit.name
+		}
+	}
+	return fmt.Sprintf("%dbit", uint(b))
+}
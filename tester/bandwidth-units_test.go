@@ -0,0 +1,85 @@
+package tester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Bandwidth
+		wantErr string
+	}{
+		{input: "50mbit", want: 50_000_000},
+		{input: "6.5Mbps", want: 6_500_000},
+		{input: "12.5MB/s", want: 100_000_000},
+		{input: "1KiB/s", want: 8192},
+		{input: "1kbit", want: 1_000},
+		{input: "800kbit", want: 800_000},
+		{input: "1gbit", want: 1_000_000_000},
+		{input: "2 mbit", want: 2_000_000},
+		{input: "50_000_000", want: 50_000_000},
+		{input: "1.5mbit", want: 1_500_000},
+		{input: "", wantErr: "invalid bandwidth"},
+		{input: "mbit", wantErr: "invalid bandwidth"},
+		{input: "50furlongs", wantErr: "unknown bandwidth unit"},
+		{input: "-5mbit", wantErr: "invalid bandwidth"},
+		{input: "100000000tbit", wantErr: "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseBandwidth(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseBandwidth(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBandwidth(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBandwidthStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		bandwidth Bandwidth
+		want      string
+	}{
+		{999, "999bit"},
+		{1_000, "1kbit"},
+		{1_500, "1.5kbit"},
+		{999_999, "999.999kbit"},
+		{1_000_000, "1mbit"},
+		{1_500_000, "1.5mbit"},
+		{1_234_567, "1.234567mbit"},
+		{999_999_999, "999.999999mbit"},
+		{1_000_000_000, "1gbit"},
+		{2_500_000_001, "2.500000001gbit"},
+	}
+	for _, tt := range tests {
+		if got := tt.bandwidth.String(); got != tt.want {
+			t.Errorf("Bandwidth(%d).String() = %q, want %q", tt.bandwidth, got, tt.want)
+		}
+		parsed, err := ParseBandwidth(tt.bandwidth.String())
+		if err != nil {
+			t.Errorf("ParseBandwidth(%q) error = %v", tt.bandwidth.String(), err)
+		} else if parsed != tt.bandwidth {
+			t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.bandwidth.String(), parsed, tt.bandwidth)
+		}
+	}
+
+	// The same rate written in different units parses to the same bandwidth.
+	for _, pair := range [][2]string{{"1500kbit", "1.5mbit"}, {"1000mbit", "1gbit"}, {"125kB/s", "1mbit"}} {
+		a, errA := ParseBandwidth(pair[0])
+		b, errB := ParseBandwidth(pair[1])
+		if errA != nil || errB != nil || a != b {
+			t.Errorf("ParseBandwidth(%q) = %d, %v and ParseBandwidth(%q) = %d, %v, want equal", pair[0], a, errA, pair[1], b, errB)
+		}
+	}
+}
@@ -2,118 +2,292 @@ package tester
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
 	"github.com/pkg/errors"
 )
 
-// FormatBandwidth converts a bandwidth value in bits per second to a tc-compatible string
-// e.g. 1000000 -> "1mbit", 2000 -> "2kbit"
-func FormatBandwidth(bitsPerSecond uint) string {
-	if bitsPerSecond >= 1000000000 {
-		return fmt.Sprintf("%dgbit", bitsPerSecond/1000000000)
-	} else if bitsPerSecond >= 1000000 {
-		return fmt.Sprintf("%dmbit", bitsPerSecond/1000000)
-	} else if bitsPerSecond >= 1000 {
-		return fmt.Sprintf("%dkbit", bitsPerSecond/1000)
+// TcShaper is a Shaper that runs tc inside the target service's container.
+type TcShaper struct {
+	mu      sync.Mutex
+	dev     string
+	devs    map[services.ServiceName]string
+	applied map[services.ServiceName]Limits
+}
+
+// NewTcShaper returns a shaper for the interface dev, which is detected in each service if empty.
+func NewTcShaper(dev string) *TcShaper {
+	return &TcShaper{
+		dev:     dev,
+		devs:    make(map[services.ServiceName]string),
+		applied: make(map[services.ServiceName]Limits),
 	}
-	return fmt.Sprintf("%dbit", bitsPerSecond)
 }
 
-func InstallTcCommand(service *services.ServiceContext) error {
-	log.Info("Updating apt cache")
-	exit, logs, err := service.ExecCommand(strings.Split("apt update", " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to update apt")
+// device returns the interface to shape in the service, detecting it the first time it's needed.
+func (s *TcShaper) device(service *services.ServiceContext) (string, error) {
+	if s.dev != "" {
+		return s.dev, nil
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to update apt: %s", logs)
+	if dev, ok := s.devs[service.GetServiceName()]; ok {
+		return dev, nil
 	}
 
-	// Alpine Linux: iproute2-tc
-	// Ubuntu: iproute2
-	log.Info("Installing tc command")
-	exit, logs, err = service.ExecCommand(strings.Split("apt install iproute2 -y", " "))
+	dev, err := detectInterface(service)
 	if err != nil {
-		return errors.Wrap(err, "failed to install tc command")
+		return "", errors.Wrap(err, "failed to detect network interface")
+	}
+	log.Info("Detected network interface", "service", service.GetServiceName(), "dev", dev)
+	s.devs[service.GetServiceName()] = dev
+	return dev, nil
+}
+
+// execCommand runs a space-separated command in the service's network namespace, treating a non-zero
+// exit code as an error described by description.
+func execCommand(service *services.ServiceContext, command string, description string) (string, error) {
+	exit, logs, err := service.ExecCommand(strings.Split(command, " "))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to %s", description)
 	}
 	if exit != 0 {
-		return fmt.Errorf("failed to install tc command: %s", logs)
+		return logs, fmt.Errorf("failed to %s: %s", description, logs)
 	}
 
-	return nil
+	return logs, nil
 }
 
-func SetUploadBandwidthControl(service *services.ServiceContext, uploadBandwidthBps uint) error {
-	bandwidthStr := FormatBandwidth(uploadBandwidthBps)
-	log.Info("Setting upload bandwidth control", "bandwidth", bandwidthStr)
-	tcCmd := fmt.Sprintf("tc qdisc add dev eth0 root tbf rate %s burst 16kb latency 50ms", bandwidthStr)
-	exit, logs, err := service.ExecCommand(strings.Split(tcCmd, " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to create qdisc for upload bandwidth control")
+const ifbDevice = "ifb0"
+
+// setShapingQdiscs installs the qdiscs that shape traffic leaving dev under parent, which is either
+// "root" or a class such as "parent 1:1". Network impairments are emulated by a netem qdisc, with
+// the rate limit as its child so that delayed packets still count against the bandwidth. The first
+// qdisc gets the handle major: and the rate limit under netem gets major+0x100:, so the handles of
+// different bands never collide as long as major is below 0x100.
+func (s *TcShaper) setShapingQdiscs(service *services.ServiceContext, dev string, parent string, major uint, bandwidth Bandwidth, netem NetemParams) error {
+	rateArgs := ""
+	if bandwidth > 0 {
+		rateArgs = fmt.Sprintf("tbf rate %s burst 16kb latency 50ms", bandwidth)
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to create qdisc for upload bandwidth control: %s", logs)
+
+	if netem.IsZero() {
+		log.Info("Setting bandwidth control", "dev", dev, "bandwidth", bandwidth.String())
+		_, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s %s handle %x: %s", dev, parent, major, rateArgs), "create qdisc for bandwidth control")
+		return err
 	}
 
-	return nil
+	log.Info("Setting network emulation", "dev", dev, "netem", netem.Args())
+	if _, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s %s handle %x: netem %s", dev, parent, major, netem.Args()), "create qdisc for network emulation"); err != nil {
+		return err
+	}
+
+	if rateArgs == "" {
+		return nil
+	}
+
+	log.Info("Setting bandwidth control", "dev", dev, "bandwidth", bandwidth.String())
+	_, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s parent %x:1 handle %x: %s", dev, major, major+0x100, rateArgs), "create qdisc for bandwidth control")
+	return err
 }
 
-func SetDownloadBandwidthControl(service *services.ServiceContext, downloadBandwidthBps uint) error {
-	log.Info("Creating qdisc for download bandwidth control")
-	exit, logs, err := service.ExecCommand(strings.Split("tc qdisc add dev eth0 handle ffff: ingress", " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to create qdisc for download bandwidth control")
+// portMatches returns u32 selectors for packets to or from each of the ports.
+func portMatches(ports []Port) []string {
+	var matches []string
+	for _, port := range ports {
+		protocol := 6
+		if port.Protocol == PortProtocolUDP {
+			protocol = 17
+		}
+		for _, field := range []string{"sport", "dport"} {
+			matches = append(matches, fmt.Sprintf("match ip protocol %d 0xff match ip %s %d 0xffff", protocol, field, port.Number))
+		}
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to create qdisc for download bandwidth control: %s", logs)
+	return matches
+}
+
+// egressClass is a subset of egress traffic, selected by u32 matches, with its own limits.
+type egressClass struct {
+	matches   []string
+	bandwidth Bandwidth
+	netem     NetemParams
+}
+
+func (c egressClass) shaped() bool {
+	return c.bandwidth > 0 || !c.netem.IsZero()
+}
+
+// egressClasses splits egress traffic into the classes that are shaped separately, in the order
+// their filters are tried, and the class for the remaining traffic. Traffic to each group of peers
+// gets the peers' limits, and the default upload bandwidth if they don't set one, so that it
+// doesn't escape the limit. When shaping is scoped to ports, only traffic to or from the ports is
+// shaped.
+func egressClasses(limits Limits) ([]egressClass, egressClass) {
+	var classes []egressClass
+	for _, peer := range limits.Peers {
+		class := egressClass{bandwidth: peer.UploadBandwidth, netem: peer.Netem}
+		if class.bandwidth == 0 {
+			class.bandwidth = limits.UploadBandwidth
+		}
+		for _, ip := range peer.IPs {
+			destination := fmt.Sprintf("match ip dst %s/32", ip)
+			if len(limits.Ports) == 0 {
+				class.matches = append(class.matches, destination)
+			}
+			for _, match := range portMatches(limits.Ports) {
+				class.matches = append(class.matches, destination+" "+match)
+			}
+		}
+		classes = append(classes, class)
 	}
 
-	bandwidthStr := FormatBandwidth(downloadBandwidthBps)
-	log.Info("Setting download bandwidth control", "bandwidth", bandwidthStr)
-	filterCmd := fmt.Sprintf("tc filter add dev eth0 parent ffff: protocol ip prio 1 u32 match ip src 0.0.0.0/0 police rate %s burst 16kb drop flowid :1", bandwidthStr)
-	exit, logs, err = service.ExecCommand(strings.Split(filterCmd, " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to set download bandwidth control")
+	if len(limits.Ports) == 0 {
+		return classes, egressClass{bandwidth: limits.UploadBandwidth, netem: limits.Netem}
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to set download bandwidth control: %s", logs)
+
+	scoped := egressClass{matches: portMatches(limits.Ports), bandwidth: limits.UploadBandwidth, netem: limits.Netem}
+	return append(classes, scoped), egressClass{}
+}
+
+func (s *TcShaper) setEgressControl(service *services.ServiceContext, dev string, limits Limits) error {
+	classes, rest := egressClasses(limits)
+	if len(classes) == 0 {
+		return s.setShapingQdiscs(service, dev, "root", 1, rest.bandwidth, rest.netem)
+	}
+
+	// Each class gets a band of a prio qdisc where it is shaped, and the remaining traffic goes
+	// through the last band.
+	bands := len(classes) + 1
+	priomap := strings.TrimSpace(strings.Repeat(fmt.Sprintf("%d ", bands-1), 16))
+	log.Info("Creating qdisc for classified upload bandwidth control", "dev", dev, "bands", bands)
+	if _, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s root handle 1: prio bands %d priomap %s", dev, bands, priomap), "create qdisc for classified bandwidth control"); err != nil {
+		return err
+	}
+
+	for i, class := range append(classes, rest) {
+		band := i + 1
+		if class.shaped() {
+			if err := s.setShapingQdiscs(service, dev, fmt.Sprintf("parent 1:%x", band), uint(0x10+band), class.bandwidth, class.netem); err != nil {
+				return err
+			}
+		}
+
+		for _, match := range class.matches {
+			filterCmd := fmt.Sprintf("tc filter add dev %s parent 1: protocol ip prio %d u32 %s flowid 1:%x", dev, band, match, band)
+			if _, err := execCommand(service, filterCmd, "classify upload traffic"); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func RemoveUploadBandwidthControl(service *services.ServiceContext) error {
-	log.Info("Removing upload bandwidth control")
-	exit, logs, err := service.ExecCommand(strings.Split("tc qdisc del dev eth0 root", " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to remove upload bandwidth control")
+func (s *TcShaper) setIngressControl(service *services.ServiceContext, dev string, limits Limits) error {
+	switch limits.DownloadLimiter {
+	case DownloadLimiterIFB:
+		return s.setIfbDownloadControl(service, dev, limits)
+	default:
+		return s.setDownloadBandwidthControl(service, dev, limits.DownloadBandwidth, limits.Ports)
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to remove upload bandwidth control: %s", logs)
+}
+
+func (s *TcShaper) setDownloadBandwidthControl(service *services.ServiceContext, dev string, downloadBandwidth Bandwidth, ports []Port) error {
+	log.Info("Creating qdisc for download bandwidth control")
+	if _, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s handle ffff: ingress", dev), "create qdisc for download bandwidth control"); err != nil {
+		return err
 	}
 
+	bandwidthStr := downloadBandwidth.String()
+	log.Info("Setting download bandwidth control", "bandwidth", bandwidthStr)
+	if len(ports) == 0 {
+		filterCmd := fmt.Sprintf("tc filter add dev %s parent ffff: protocol ip prio 1 u32 match ip src 0.0.0.0/0 police rate %s burst 16kb drop flowid :1", dev, bandwidthStr)
+		_, err := execCommand(service, filterCmd, "set download bandwidth control")
+		return err
+	}
+
+	// The filters share one policer so that the ports are limited together rather than each getting
+	// the full rate.
+	police := fmt.Sprintf("police rate %s burst 16kb drop index 1", bandwidthStr)
+	for _, match := range portMatches(ports) {
+		filterCmd := fmt.Sprintf("tc filter add dev %s parent ffff: protocol ip prio 1 u32 %s action %s flowid :1", dev, match, police)
+		if _, err := execCommand(service, filterCmd, "set scoped download bandwidth control"); err != nil {
+			return err
+		}
+		police = "police index 1"
+	}
 	return nil
 }
 
-func RemoveDownloadBandwidthControl(service *services.ServiceContext) error {
-	log.Info("Removing download bandwidth control")
-	exit, logs, err := service.ExecCommand(strings.Split("tc qdisc del dev eth0 handle ffff: ingress", " "))
-	if err != nil {
-		return errors.Wrap(err, "failed to remove download bandwidth control")
+// setIfbDownloadControl redirects ingress traffic to an IFB device so that it can be queued and
+// shaped like egress traffic instead of being dropped by a policer.
+func (s *TcShaper) setIfbDownloadControl(service *services.ServiceContext, dev string, limits Limits) error {
+	log.Info("Creating IFB device for download bandwidth control", "dev", ifbDevice)
+	if _, err := execCommand(service, fmt.Sprintf("ip link add %s type ifb", ifbDevice), "create ifb device"); err != nil {
+		return err
 	}
-	if exit != 0 {
-		return fmt.Errorf("failed to remove download bandwidth control: %s", logs)
+	if _, err := execCommand(service, fmt.Sprintf("ip link set dev %s up", ifbDevice), "bring up ifb device"); err != nil {
+		return err
 	}
 
-	return nil
+	log.Info("Creating qdisc for download bandwidth control")
+	if _, err := execCommand(service, fmt.Sprintf("tc qdisc add dev %s handle ffff: ingress", dev), "create qdisc for download bandwidth control"); err != nil {
+		return err
+	}
+
+	// Only the traffic in scope is redirected, so everything on the IFB device is shaped.
+	filterCmds := []string{fmt.Sprintf("tc filter add dev %s parent ffff: protocol all u32 match u32 0 0 action mirred egress redirect dev %s", dev, ifbDevice)}
+	if len(limits.Ports) > 0 {
+		filterCmds = nil
+		for _, match := range portMatches(limits.Ports) {
+			filterCmds = append(filterCmds, fmt.Sprintf("tc filter add dev %s parent ffff: protocol ip prio 1 u32 %s action mirred egress redirect dev %s", dev, match, ifbDevice))
+		}
+	}
+	for _, filterCmd := range filterCmds {
+		if _, err := execCommand(service, filterCmd, "redirect ingress traffic to ifb device"); err != nil {
+			return err
+		}
+	}
+
+	return s.setShapingQdiscs(service, ifbDevice, "root", 1, limits.DownloadBandwidth, limits.DownloadNetem)
+}
+
+func (s *TcShaper) removeEgressControl(service *services.ServiceContext, dev string) error {
+	log.Info("Removing upload bandwidth control")
+	_, err := execCommand(service, fmt.Sprintf("tc qdisc del dev %s root", dev), "remove upload bandwidth control")
+	return err
+}
+
+// removeIngressControl removes the ingress qdisc along with the IFB device if one was created.
+// Deleting the device also deletes its qdiscs.
+func (s *TcShaper) removeIngressControl(service *services.ServiceContext, dev string) error {
+	log.Info("Removing download bandwidth control")
+	_, err := execCommand(service, fmt.Sprintf("tc qdisc del dev %s handle ffff: ingress", dev), "remove download bandwidth control")
+
+	if _, ifbErr := execCommand(service, fmt.Sprintf("ip link del %s", ifbDevice), "remove ifb device"); ifbErr != nil {
+		log.Debug("No IFB device to remove", "message", ifbErr)
+	}
+
+	return err
 }
 
-func RemoveBandwidthControls(service *services.ServiceContext) error {
-	uploadErr := RemoveUploadBandwidthControl(service)
-	downloadErr := RemoveDownloadBandwidthControl(service)
+// removeBandwidthControls removes whichever of the upload and download controls are installed on
+// dev, so that a direction that was never shaped isn't an error.
+func (s *TcShaper) removeBandwidthControls(service *services.ServiceContext, dev string) error {
+	state, err := GetTcState(service, dev)
+	if err != nil {
+		return errors.Wrap(err, "failed to read existing bandwidth controls")
+	}
+
+	var uploadErr, downloadErr error
+	if state.HasEgressControl() {
+		uploadErr = s.removeEgressControl(service, dev)
+	}
+	if state.HasIngressControl() || state.qdisc(ifbDevice, "tbf") != nil || state.qdisc(ifbDevice, "netem") != nil {
+		downloadErr = s.removeIngressControl(service, dev)
+	}
 
 	if uploadErr != nil && downloadErr != nil {
 		return fmt.Errorf("failed to remove upload and download bandwidth controls: %s, %s", uploadErr, downloadErr)
@@ -128,17 +302,175 @@ func RemoveBandwidthControls(service *services.ServiceContext) error {
 	return nil
 }
 
-func UpdateUploadBandwidthControl(service *services.ServiceContext, uploadBandwidthBps uint) error {
-	log.Info("Updating upload bandwidth control", "bandwidth", FormatBandwidth(uploadBandwidthBps))
-	uploadErr := RemoveUploadBandwidthControl(service)
-	if uploadErr != nil {
-		return errors.Wrap(uploadErr, "failed to remove upload bandwidth control")
+func egressShaped(limits Limits) bool {
+	return limits.UploadBandwidth > 0 || !limits.Netem.IsZero() || len(limits.Peers) > 0
+}
+
+func ingressShaped(limits Limits) bool {
+	return limits.DownloadBandwidth > 0 || (limits.DownloadLimiter == DownloadLimiterIFB && !limits.DownloadNetem.IsZero())
+}
+
+func ingressLimits(limits Limits) Limits {
+	return Limits{
+		DownloadBandwidth: limits.DownloadBandwidth,
+		DownloadLimiter:   limits.DownloadLimiter,
+		DownloadNetem:     limits.DownloadNetem,
+		Ports:             limits.Ports,
 	}
+}
 
-	uploadErr = SetUploadBandwidthControl(service, uploadBandwidthBps)
-	if uploadErr != nil {
-		return errors.Wrap(uploadErr, "failed to set upload bandwidth control")
+func ingressLimitsEqual(a Limits, b Limits) bool {
+	return a.DownloadBandwidth == b.DownloadBandwidth && a.DownloadLimiter == b.DownloadLimiter && a.DownloadNetem == b.DownloadNetem && slices.Equal(a.Ports, b.Ports)
+}
+
+func (s *TcShaper) setLimits(service *services.ServiceContext, dev string, limits Limits) error {
+	if ingressShaped(limits) {
+		if err := s.setIngressControl(service, dev, limits); err != nil {
+			return errors.Wrap(err, "failed to set download bandwidth control")
+		}
+	}
+
+	if egressShaped(limits) {
+		if err := s.setEgressControl(service, dev, limits); err != nil {
+			return errors.Wrap(err, "failed to set upload bandwidth control")
+		}
 	}
 
 	return nil
 }
+
+func (s *TcShaper) Apply(service *services.ServiceContext, limits Limits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := installTcCommand(service); err != nil {
+		return errors.Wrap(err, "failed to install tc command")
+	}
+
+	dev, err := s.device(service)
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeBandwidthControls(service, dev); err != nil {
+		return errors.Wrap(err, "failed to remove existing bandwidth controls")
+	}
+	delete(s.applied, service.GetServiceName())
+
+	if err := s.setLimits(service, dev, limits); err != nil {
+		return err
+	}
+	s.applied[service.GetServiceName()] = limits
+
+	return s.verify(service, dev, limits)
+}
+
+// verify reads back the controls in effect in the service and checks that they enforce limits.
+func (s *TcShaper) verify(service *services.ServiceContext, dev string, limits Limits) error {
+	state, err := GetTcState(service, dev)
+	if err != nil {
+		return errors.Wrap(err, "failed to read back bandwidth controls")
+	}
+	if err := state.Verify(limits); err != nil {
+		return errors.Wrap(err, "bandwidth controls don't match the requested limits")
+	}
+	return nil
+}
+
+// Update replaces only the controls whose limits have changed, so that an upload change doesn't
+// briefly lift the download limit and vice versa.
+func (s *TcShaper) Update(service *services.ServiceContext, limits Limits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.applied[service.GetServiceName()]
+	if !ok {
+		return fmt.Errorf("no limits have been applied to %s", service.GetServiceName())
+	}
+
+	dev, err := s.device(service)
+	if err != nil {
+		return err
+	}
+
+	// A change of scope affects both directions, so start again.
+	if !slices.Equal(limits.Ports, current.Ports) || !slices.EqualFunc(limits.Peers, current.Peers, peerLimitsEqual) {
+		log.Info("Updating bandwidth control scope", "ports", len(limits.Ports))
+		if err := s.removeBandwidthControls(service, dev); err != nil {
+			return err
+		}
+		delete(s.applied, service.GetServiceName())
+
+		if err := s.setLimits(service, dev, limits); err != nil {
+			return err
+		}
+		s.applied[service.GetServiceName()] = limits
+		return s.verify(service, dev, limits)
+	}
+
+	if limits.UploadBandwidth != current.UploadBandwidth || limits.Netem != current.Netem {
+		log.Info("Updating upload bandwidth control", "bandwidth", limits.UploadBandwidth.String(), "netem", limits.Netem.Args())
+		if egressShaped(current) {
+			if err := s.removeEgressControl(service, dev); err != nil {
+				return errors.Wrap(err, "failed to remove upload bandwidth control")
+			}
+		}
+		current.UploadBandwidth = 0
+		current.Netem = NetemParams{}
+		s.applied[service.GetServiceName()] = current
+
+		egress := Limits{UploadBandwidth: limits.UploadBandwidth, Netem: limits.Netem, Ports: limits.Ports, Peers: limits.Peers}
+		if err := s.setLimits(service, dev, egress); err != nil {
+			return err
+		}
+		current.UploadBandwidth = limits.UploadBandwidth
+		current.Netem = limits.Netem
+		s.applied[service.GetServiceName()] = current
+	}
+
+	if !ingressLimitsEqual(limits, current) {
+		log.Info("Updating download bandwidth control", "bandwidth", limits.DownloadBandwidth.String(), "limiter", limits.DownloadLimiter)
+		if ingressShaped(current) {
+			if err := s.removeIngressControl(service, dev); err != nil {
+				return errors.Wrap(err, "failed to remove download bandwidth control")
+			}
+		}
+		current.DownloadBandwidth = 0
+		current.DownloadLimiter = ""
+		current.DownloadNetem = NetemParams{}
+		s.applied[service.GetServiceName()] = current
+
+		if err := s.setLimits(service, dev, ingressLimits(limits)); err != nil {
+			return err
+		}
+		current.DownloadBandwidth = limits.DownloadBandwidth
+		current.DownloadLimiter = limits.DownloadLimiter
+		current.DownloadNetem = limits.DownloadNetem
+		s.applied[service.GetServiceName()] = current
+	}
+
+	return s.verify(service, dev, limits)
+}
+
+func (s *TcShaper) Remove(service *services.ServiceContext) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.applied, service.GetServiceName())
+	dev, err := s.device(service)
+	if err == nil {
+		err = s.removeBandwidthControls(service, dev)
+	}
+	return err
+}
+
+func (s *TcShaper) Inspect(service *services.ServiceContext) (*TcState, error) {
+	s.mu.Lock()
+	dev, err := s.device(service)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetTcState(service, dev)
+}
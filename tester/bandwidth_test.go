@@ -0,0 +1,98 @@
+package tester
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/kurtosis_core_rpc_api_bindings"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"google.golang.org/grpc"
+)
+
+// execClient is an API container client that answers ExecCommand with exec, so that tests can fake
+// the commands run in a service. Any other call panics.
+type execClient struct {
+	kurtosis_core_rpc_api_bindings.ApiContainerServiceClient
+	exec func(command []string) (int32, string)
+}
+
+func (c execClient) ExecCommand(ctx context.Context, args *kurtosis_core_rpc_api_bindings.ExecCommandArgs, opts ...grpc.CallOption) (*kurtosis_core_rpc_api_bindings.ExecCommandResponse, error) {
+	exit, output := c.exec(args.GetCommandArgs())
+	return &kurtosis_core_rpc_api_bindings.ExecCommandResponse{ExitCode: exit, LogOutput: output}, nil
+}
+
+// newExecService returns the service newTestService does, with the commands run in it answered by
+// exec.
+func newExecService(exec func(command []string) (int32, string)) *services.ServiceContext {
+	return services.NewServiceContext(execClient{exec: exec}, "cl-1-prysm-geth", "uuid", "10.0.0.1", nil, "", nil)
+}
+
+// recordingRunner records the commands run in a service and succeeds without running them.
+type recordingRunner struct {
+	commands []string
+}
+
+func (r *recordingRunner) exec(command []string) (int32, string) {
+	r.commands = append(r.commands, strings.Join(command, " "))
+	return 0, ""
+}
+
+func TestEgressControlHandlesAreUnique(t *testing.T) {
+	limits := Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 50_000_000}}
+	for i := 0; i < maxPeerPolicies; i++ {
+		limits.Peers = append(limits.Peers, PeerLimits{
+			IPs:             []string{"10.0.0.1"},
+			UploadBandwidth: 10_000_000,
+			Netem:           NetemParams{Latency: 100_000_000},
+		})
+	}
+
+	runner := &recordingRunner{}
+	shaper := NewTcShaper("eth0")
+	if err := shaper.setEgressControl(newExecService(runner.exec), "eth0", limits); err != nil {
+		t.Fatalf("setEgressControl() error = %v", err)
+	}
+
+	handles := make(map[string]string)
+	handlePattern := regexp.MustCompile(`qdisc add dev eth0 .* handle ([0-9a-f]+):`)
+	for _, command := range runner.commands {
+		match := handlePattern.FindStringSubmatch(command)
+		if match == nil {
+			continue
+		}
+		if previous, ok := handles[match[1]]; ok {
+			t.Errorf("handle %s: is used by both %q and %q", match[1], previous, command)
+		}
+		handles[match[1]] = command
+	}
+	// The prio qdisc, then a netem and tbf qdisc for each band.
+	if want := 1 + 2*(maxPeerPolicies+1); len(handles) != want {
+		t.Errorf("got %d qdiscs, want %d", len(handles), want)
+	}
+}
+
+func TestEgressClassesInheritUploadBandwidth(t *testing.T) {
+	limits := Limits{
+		UploadBandwidth: 50_000_000,
+		Peers: []PeerLimits{
+			{IPs: []string{"10.0.0.1"}, Netem: NetemParams{Latency: 100_000_000}},
+			{IPs: []string{"10.0.0.2"}, UploadBandwidth: 10_000_000},
+		},
+	}
+
+	classes, rest := egressClasses(limits)
+	if len(classes) != 2 {
+		t.Fatalf("got %d classes, want 2", len(classes))
+	}
+	if classes[0].bandwidth != 50_000_000 {
+		t.Errorf("netem-only peer bandwidth = %s, want the default 50mbit", classes[0].bandwidth)
+	}
+	if classes[1].bandwidth != 10_000_000 {
+		t.Errorf("peer bandwidth = %s, want its own 10mbit", classes[1].bandwidth)
+	}
+	if rest.bandwidth != 50_000_000 {
+		t.Errorf("remaining traffic bandwidth = %s, want 50mbit", rest.bandwidth)
+	}
+}
@@ -0,0 +1,196 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type BlockHeader struct {
+	Slot          uint64
+	Root          string
+	ParentRoot    string
+	ProposerIndex uint64
+	Canonical     bool
+}
+
+// headerData is a header as the API returns it.
+type headerData struct {
+	Root      string `json:"root"`
+	Canonical bool   `json:"canonical"`
+	Header    struct {
+		Message struct {
+			Slot          string `json:"slot"`
+			ProposerIndex string `json:"proposer_index"`
+			ParentRoot    string `json:"parent_root"`
+		} `json:"message"`
+	} `json:"header"`
+}
+
+func (h headerData) parse() (*BlockHeader, error) {
+	slot, err := strconv.ParseUint(h.Header.Message.Slot, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse slot")
+	}
+	proposerIndex, err := strconv.ParseUint(h.Header.Message.ProposerIndex, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse proposer index")
+	}
+
+	return &BlockHeader{
+		Slot:          slot,
+		Root:          h.Root,
+		ParentRoot:    h.Header.Message.ParentRoot,
+		ProposerIndex: proposerIndex,
+		Canonical:     h.Canonical,
+	}, nil
+}
+
+// BlockHeader returns the header of a block, identified by slot, root, "head" or "finalized". It
+// returns ErrNotFound for an empty slot.
+func (c *Client) BlockHeader(ctx context.Context, blockID string) (*BlockHeader, error) {
+	var data headerData
+	if err := c.get(ctx, "/eth/v1/beacon/headers/"+blockID, &data); err != nil {
+		return nil, err
+	}
+	return data.parse()
+}
+
+// BlobCount returns the number of blobs a block commits to.
+func (c *Client) BlobCount(ctx context.Context, blockID string) (int, error) {
+	var data struct {
+		Message struct {
+			Body struct {
+				BlobKZGCommitments []string `json:"blob_kzg_commitments"`
+			} `json:"body"`
+		} `json:"message"`
+	}
+	if err := c.get(ctx, "/eth/v2/beacon/blocks/"+blockID, &data); err != nil {
+		return 0, err
+	}
+	return len(data.Message.Body.BlobKZGCommitments), nil
+}
+
+// ExecutionBlockHash returns the hash of the execution payload a block carries.
+func (c *Client) ExecutionBlockHash(ctx context.Context, blockID string) (string, error) {
+	var data struct {
+		Message struct {
+			Body struct {
+				ExecutionPayload struct {
+					BlockHash string `json:"block_hash"`
+				} `json:"execution_payload"`
+			} `json:"body"`
+		} `json:"message"`
+	}
+	if err := c.get(ctx, "/eth/v2/beacon/blocks/"+blockID, &data); err != nil {
+		return "", err
+	}
+	if data.Message.Body.ExecutionPayload.BlockHash == "" {
+		return "", fmt.Errorf("block %s has no execution payload", blockID)
+	}
+	return data.Message.Body.ExecutionPayload.BlockHash, nil
+}
+
+// sidecarIndices fetches a list of sidecars and returns their indices, ignoring the rest of their
+// contents.
+func (c *Client) sidecarIndices(ctx context.Context, path string) ([]uint64, error) {
+	var data []struct {
+		Index string `json:"index"`
+	}
+	if err := c.get(ctx, path, &data); err != nil {
+		return nil, err
+	}
+
+	indices := make([]uint64, 0, len(data))
+	for _, sidecar := range data {
+		index, err := strconv.ParseUint(sidecar.Index, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sidecar index %q", sidecar.Index)
+		}
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// BlobSidecarIndices returns the indices of the blob sidecars the node has for a block.
+func (c *Client) BlobSidecarIndices(ctx context.Context, blockID string) ([]uint64, error) {
+	return c.sidecarIndices(ctx, "/eth/v1/beacon/blob_sidecars/"+blockID)
+}
+
+// DataColumnSidecarIndices returns the indices of the data column sidecars the node has for a block
+// from Fulu onwards.
+func (c *Client) DataColumnSidecarIndices(ctx context.Context, blockID string) ([]uint64, error) {
+	return c.sidecarIndices(ctx, "/eth/v1/debug/beacon/data_column_sidecars/"+blockID)
+}
+
+// CustodyGroupCount returns the number of custody groups the node advertises in its metadata.
+func (c *Client) CustodyGroupCount(ctx context.Context) (uint64, error) {
+	var data struct {
+		Metadata struct {
+			CustodyGroupCount string `json:"custody_group_count"`
+		} `json:"metadata"`
+	}
+	if err := c.get(ctx, "/eth/v1/node/identity", &data); err != nil {
+		return 0, err
+	}
+	if data.Metadata.CustodyGroupCount == "" {
+		return 0, fmt.Errorf("node identity has no custody group count")
+	}
+
+	count, err := strconv.ParseUint(data.Metadata.CustodyGroupCount, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse custody group count")
+	}
+	return count, nil
+}
+
+// BlockHeaders returns the headers of every block the node knows of at a slot, including those that
+// aren't canonical.
+func (c *Client) BlockHeaders(ctx context.Context, slot uint64) ([]BlockHeader, error) {
+	var data []headerData
+	if err := c.get(ctx, fmt.Sprintf("/eth/v1/beacon/headers?slot=%d", slot), &data); err != nil {
+		return nil, err
+	}
+
+	headers := make([]BlockHeader, 0, len(data))
+	for _, h := range data {
+		header, err := h.parse()
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, *header)
+	}
+	return headers, nil
+}
+
+type ProposerDuty struct {
+	Slot           uint64
+	ValidatorIndex uint64
+}
+
+// ProposerDuties returns the proposer of each slot of an epoch.
+func (c *Client) ProposerDuties(ctx context.Context, epoch uint64) ([]ProposerDuty, error) {
+	var data []struct {
+		Slot           string `json:"slot"`
+		ValidatorIndex string `json:"validator_index"`
+	}
+	if err := c.get(ctx, fmt.Sprintf("/eth/v1/validator/duties/proposer/%d", epoch), &data); err != nil {
+		return nil, err
+	}
+
+	duties := make([]ProposerDuty, 0, len(data))
+	for _, duty := range data {
+		slot, err := strconv.ParseUint(duty.Slot, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse slot")
+		}
+		validatorIndex, err := strconv.ParseUint(duty.ValidatorIndex, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse validator index")
+		}
+		duties = append(duties, ProposerDuty{Slot: slot, ValidatorIndex: validatorIndex})
+	}
+	return duties, nil
+}
@@ -0,0 +1,208 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when the node doesn't have what was requested, e.g. the block of an empty
+// slot.
+var ErrNotFound = errors.New("not found")
+
+// Client is a minimal client for the standard beacon node API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a Client for the beacon API at baseURL, e.g. http://127.0.0.1:4000.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// get fetches path and decodes the "data" field of the response into out.
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for %s", path)
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get %s", path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.Wrapf(ErrNotFound, "failed to get %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to get %s: status %d, body: %s", path, resp.StatusCode, string(body))
+	}
+
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return errors.Wrapf(err, "failed to decode %s response", path)
+	}
+
+	return nil
+}
+
+type Genesis struct {
+	GenesisTime           time.Time
+	GenesisValidatorsRoot string
+	GenesisForkVersion    string
+}
+
+// Genesis returns the genesis of the chain the node is following.
+func (c *Client) Genesis(ctx context.Context) (*Genesis, error) {
+	var data struct {
+		GenesisTime           string `json:"genesis_time"`
+		GenesisValidatorsRoot string `json:"genesis_validators_root"`
+		GenesisForkVersion    string `json:"genesis_fork_version"`
+	}
+	if err := c.get(ctx, "/eth/v1/beacon/genesis", &data); err != nil {
+		return nil, err
+	}
+
+	genesisTime, err := strconv.ParseInt(data.GenesisTime, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse genesis time")
+	}
+
+	return &Genesis{
+		GenesisTime:           time.Unix(genesisTime, 0),
+		GenesisValidatorsRoot: data.GenesisValidatorsRoot,
+		GenesisForkVersion:    data.GenesisForkVersion,
+	}, nil
+}
+
+type Spec struct {
+	SlotDuration  time.Duration
+	SlotsPerEpoch uint64
+	// NumberOfColumns and NumberOfCustodyGroups are zero before Fulu is configured.
+	NumberOfColumns       uint64
+	NumberOfCustodyGroups uint64
+	// ForkEpochs maps lowercase fork names (e.g. "electra", "fulu") to their activation epochs.
+	ForkEpochs map[string]uint64
+	// BlobSchedule is the maximum number of blobs per block from each epoch, in epoch order.
+	BlobSchedule []BlobScheduleEntry
+}
+
+type BlobScheduleEntry struct {
+	Epoch            uint64
+	MaxBlobsPerBlock uint64
+}
+
+// MaxBlobsPerBlock returns the maximum number of blobs a block may include at the epoch, or zero if
+// blobs aren't enabled yet.
+func (s *Spec) MaxBlobsPerBlock(epoch uint64) uint64 {
+	var max uint64
+	for _, entry := range s.BlobSchedule {
+		if entry.Epoch > epoch {
+			break
+		}
+		max = entry.MaxBlobsPerBlock
+	}
+	return max
+}
+
+// Spec returns the chain configuration the node is running with.
+func (c *Client) Spec(ctx context.Context) (*Spec, error) {
+	// Most values are strings, but some (e.g. BLOB_SCHEDULE) are lists, so only strings are kept.
+	var data map[string]interface{}
+	if err := c.get(ctx, "/eth/v1/config/spec", &data); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for key, value := range data {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		values[key] = n
+	}
+
+	spec := &Spec{
+		ForkEpochs: make(map[string]uint64),
+	}
+
+	if secondsPerSlot, ok := values["SECONDS_PER_SLOT"]; ok {
+		spec.SlotDuration = time.Duration(secondsPerSlot) * time.Second
+	} else if slotDurationMs, ok := values["SLOT_DURATION_MS"]; ok {
+		spec.SlotDuration = time.Duration(slotDurationMs) * time.Millisecond
+	} else {
+		return nil, fmt.Errorf("spec is missing SECONDS_PER_SLOT")
+	}
+
+	slotsPerEpoch, ok := values["SLOTS_PER_EPOCH"]
+	if !ok {
+		return nil, fmt.Errorf("spec is missing SLOTS_PER_EPOCH")
+	}
+	spec.SlotsPerEpoch = slotsPerEpoch
+	spec.NumberOfColumns = values["NUMBER_OF_COLUMNS"]
+	spec.NumberOfCustodyGroups = values["NUMBER_OF_CUSTODY_GROUPS"]
+
+	for key, value := range values {
+		if fork, ok := strings.CutSuffix(key, "_FORK_EPOCH"); ok {
+			spec.ForkEpochs[strings.ToLower(fork)] = value
+		}
+	}
+
+	// Deneb and Electra set the limit with constants, and later forks with BLOB_SCHEDULE.
+	if max, ok := values["MAX_BLOBS_PER_BLOCK"]; ok {
+		if epoch, ok := spec.ForkEpochs["deneb"]; ok {
+			spec.BlobSchedule = append(spec.BlobSchedule, BlobScheduleEntry{Epoch: epoch, MaxBlobsPerBlock: max})
+		}
+	}
+	if max, ok := values["MAX_BLOBS_PER_BLOCK_ELECTRA"]; ok {
+		if epoch, ok := spec.ForkEpochs["electra"]; ok {
+			spec.BlobSchedule = append(spec.BlobSchedule, BlobScheduleEntry{Epoch: epoch, MaxBlobsPerBlock: max})
+		}
+	}
+	if schedule, ok := data["BLOB_SCHEDULE"].([]interface{}); ok {
+		for _, item := range schedule {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			epochString, _ := entry["EPOCH"].(string)
+			maxString, _ := entry["MAX_BLOBS_PER_BLOCK"].(string)
+			epoch, err := strconv.ParseUint(epochString, 10, 64)
+			if err != nil {
+				continue
+			}
+			max, err := strconv.ParseUint(maxString, 10, 64)
+			if err != nil {
+				continue
+			}
+			spec.BlobSchedule = append(spec.BlobSchedule, BlobScheduleEntry{Epoch: epoch, MaxBlobsPerBlock: max})
+		}
+	}
+	sort.SliceStable(spec.BlobSchedule, func(i, j int) bool {
+		return spec.BlobSchedule[i].Epoch < spec.BlobSchedule[j].Epoch
+	})
+
+	return spec, nil
+}
@@ -0,0 +1,49 @@
+package beacon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const fuluSpec = `{"data": {
+	"SECONDS_PER_SLOT": "12",
+	"SLOTS_PER_EPOCH": "32",
+	"DENEB_FORK_EPOCH": "0",
+	"ELECTRA_FORK_EPOCH": "0",
+	"FULU_FORK_EPOCH": "10",
+	"MAX_BLOBS_PER_BLOCK": "6",
+	"MAX_BLOBS_PER_BLOCK_ELECTRA": "9",
+	"BLOB_SCHEDULE": [
+		{"EPOCH": "20", "MAX_BLOBS_PER_BLOCK": "15"},
+		{"EPOCH": "10", "MAX_BLOBS_PER_BLOCK": "12"}
+	]
+}}`
+
+func TestSpecMaxBlobsPerBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fuluSpec))
+	}))
+	defer server.Close()
+
+	spec, err := NewClient(server.URL).Spec(context.Background())
+	if err != nil {
+		t.Fatalf("Spec() error = %v", err)
+	}
+
+	tests := []struct {
+		epoch uint64
+		want  uint64
+	}{
+		{epoch: 0, want: 9},
+		{epoch: 9, want: 9},
+		{epoch: 10, want: 12},
+		{epoch: 25, want: 15},
+	}
+	for _, tt := range tests {
+		if got := spec.MaxBlobsPerBlock(tt.epoch); got != tt.want {
+			t.Errorf("MaxBlobsPerBlock(%d) = %d, want %d", tt.epoch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package beacon
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedTopic is returned when the node rejects a subscription, usually because it doesn't
+// implement the topic.
+var ErrUnsupportedTopic = errors.New("unsupported event topic")
+
+// Event is a server-sent event from the node's event stream.
+type Event struct {
+	Topic string
+	Data  []byte
+	// Received is when the event was read from the stream.
+	Received time.Time
+}
+
+// SubscribeEvents streams events on the topics to handle until the context is cancelled or the
+// connection fails.
+func (c *Client) SubscribeEvents(ctx context.Context, topics []string, handle func(Event)) error {
+	path := "/eth/v1/events?topics=" + strings.Join(topics, ",")
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for %s", path)
+	}
+	req.Header.Add("Accept", "text/event-stream")
+
+	// The stream stays open, so it can't share the client's timeout.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get %s", path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return errors.Wrapf(ErrUnsupportedTopic, "failed to subscribe to %s", strings.Join(topics, ","))
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to get %s: status %d, body: %s", path, resp.StatusCode, string(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event Event
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.Topic != "" {
+				event.Received = time.Now()
+				handle(event)
+			}
+			event = Event{}
+		case strings.HasPrefix(line, "event:"):
+			event.Topic = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			event.Data = append(event.Data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read event stream")
+	}
+	return fmt.Errorf("event stream closed")
+}
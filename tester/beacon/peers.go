@@ -0,0 +1,24 @@
+package beacon
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// PeerCount returns the number of peers the node is connected to.
+func (c *Client) PeerCount(ctx context.Context) (uint64, error) {
+	var data struct {
+		Connected string `json:"connected"`
+	}
+	if err := c.get(ctx, "/eth/v1/node/peer_count", &data); err != nil {
+		return 0, err
+	}
+
+	connected, err := strconv.ParseUint(data.Connected, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse connected peer count")
+	}
+	return connected, nil
+}
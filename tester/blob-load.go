@@ -0,0 +1,93 @@
+package tester
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+// blobLoad measures how many of the spammer's blobs the canonical chain actually included, since the
+// spammer can fall short of the blob count it was asked for. Blobs from other senders, such as the
+// enclave's own spamoor_blob service, aren't counted.
+type blobLoad struct {
+	client    *beacon.Client
+	execution *executionClient
+	spec      *beacon.Spec
+	spammer   common.Address
+	// rpcURL is the reference's execution client, which the spammer sends its transactions to so that
+	// they don't enter the network through a shaped node.
+	rpcURL string
+}
+
+// newBlobLoad reads blocks from the reference, which is the service under test itself if no other
+// consensus client is available, and their transactions from the reference's execution client.
+func newBlobLoad(ctx context.Context, enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext, options TestOptions, excluded []*services.ServiceContext, spammer common.Address) (*blobLoad, error) {
+	reference, err := GetReferenceService(enclaveContext, service, options.Reference, excluded)
+	if err != nil {
+		log.Warn("No reference node, loading and measuring blobs on the service under test", "error", err)
+		reference = service
+	}
+
+	beaconURL, err := GetBeaconAPIURL(reference)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get reference beacon api url")
+	}
+	client := beacon.NewClient(beaconURL)
+
+	rpcURL, err := GetExecutionRPCURL(enclaveContext, reference)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get execution rpc url")
+	}
+
+	spec, err := client.Spec(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get spec")
+	}
+	return &blobLoad{client: client, execution: newExecutionClient(rpcURL), spec: spec, spammer: spammer, rpcURL: rpcURL}, nil
+}
+
+// measure returns the median count of the spammer's blobs in the canonical blocks in the slots from
+// start up to end, and the number of blocks. The median ignores the blocks at the start of a step, before the spammer
+// has caught up with its new rate.
+func (l *blobLoad) measure(ctx context.Context, start uint64, end uint64) (uint, int, error) {
+	var counts []int
+	for slot := start; slot < end; slot++ {
+		header, err := l.client.BlockHeader(ctx, strconv.FormatUint(slot, 10))
+		if errors.Is(err, beacon.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to get block at slot %d", slot)
+		}
+		if !header.Canonical {
+			continue
+		}
+
+		blockHash, err := l.client.ExecutionBlockHash(ctx, header.Root)
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to get block at slot %d", slot)
+		}
+		count, err := l.execution.blobCountFrom(ctx, blockHash, l.spammer)
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to get blob count for slot %d", slot)
+		}
+		counts = append(counts, count)
+	}
+	return medianBlobCount(counts), len(counts), nil
+}
+
+// medianBlobCount returns the lower median of the counts, or zero if there are none.
+func medianBlobCount(counts []int) uint {
+	if len(counts) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(counts)
+	slices.Sort(sorted)
+	return uint(sorted[(len(sorted)-1)/2])
+}
@@ -0,0 +1,102 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+)
+
+func TestMedianBlobCount(t *testing.T) {
+	tests := []struct {
+		counts []int
+		want   uint
+	}{
+		{counts: nil, want: 0},
+		{counts: []int{6}, want: 6},
+		{counts: []int{0, 9, 9, 8}, want: 8},
+		{counts: []int{2, 9, 9, 9, 1}, want: 9},
+	}
+	for _, tt := range tests {
+		if got := medianBlobCount(tt.counts); got != tt.want {
+			t.Errorf("medianBlobCount(%v) = %d, want %d", tt.counts, got, tt.want)
+		}
+	}
+}
+
+func TestBlobSpammerAddress(t *testing.T) {
+	address, err := BlobSpammerAddress(DefaultBlobSpammerPrivateKey)
+	if err != nil {
+		t.Fatalf("BlobSpammerAddress() error = %v", err)
+	}
+	if want := common.HexToAddress("0xAe95d8DA9244C37CaC0a3e16BA966a8e852Bb6D6"); address != want {
+		t.Errorf("BlobSpammerAddress() = %s, want %s", address, want)
+	}
+
+	if _, err := BlobSpammerAddress("not a key"); err == nil {
+		t.Error("BlobSpammerAddress() error = nil for an invalid key")
+	}
+}
+
+func TestBlobLoadCountsOnlyTheSpammersBlobs(t *testing.T) {
+	spammer := common.HexToAddress("0xAe95d8DA9244C37CaC0a3e16BA966a8e852Bb6D6")
+	other := common.HexToAddress("0x8943545177806ED17B9F23F0a21ee5948eCaa776")
+
+	// Slot 1 is empty and slot 3's block was orphaned.
+	beaconServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slot := path.Base(r.URL.Path)
+		switch {
+		case slot == "1":
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/eth/v1/beacon/headers/"):
+			fmt.Fprintf(w, `{"data": {"root": "0xroot%s", "canonical": %t, "header": {"message": {"slot": "%s", "proposer_index": "0", "parent_root": "0x"}}}}`, slot, slot != "3", slot)
+		case strings.HasPrefix(r.URL.Path, "/eth/v2/beacon/blocks/"):
+			fmt.Fprintf(w, `{"data": {"message": {"body": {"execution_payload": {"block_hash": "0xhash%s"}}}}}`, strings.TrimPrefix(slot, "0xroot"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer beaconServer.Close()
+
+	blobs := func(from common.Address, count int) string {
+		return fmt.Sprintf(`{"from": %q, "blobVersionedHashes": [%s]}`, strings.ToLower(from.Hex()), strings.TrimSuffix(strings.Repeat(`"0x01",`, count), ","))
+	}
+	blocks := map[string]string{
+		"0xhash0": blobs(spammer, 6) + "," + blobs(other, 3),
+		"0xhash2": blobs(other, 9),
+		"0xhash3": blobs(spammer, 9),
+		"0xhash4": blobs(spammer, 4) + "," + blobs(spammer, 2) + `, {"from": "0x0000000000000000000000000000000000000001"}`,
+	}
+	executionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Method != "eth_getBlockByHash" {
+			t.Errorf("unexpected request %+v, error %v", request, err)
+		}
+		fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "result": {"transactions": [%s]}}`, blocks[request.Params[0].(string)])
+	}))
+	defer executionServer.Close()
+
+	load := &blobLoad{
+		client:    beacon.NewClient(beaconServer.URL),
+		execution: newExecutionClient(executionServer.URL),
+		spammer:   spammer,
+	}
+	included, count, err := load.measure(context.Background(), 0, 5)
+	if err != nil {
+		t.Fatalf("measure() error = %v", err)
+	}
+	// The canonical blocks include 6, 0 and 6 of the spammer's blobs.
+	if included != 6 || count != 3 {
+		t.Errorf("measure() = %d, %d, want 6, 3", included, count)
+	}
+}
@@ -0,0 +1,184 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+// ChainClock is a Clock that also knows the slots and epochs of the chain under test.
+type ChainClock struct {
+	Clock
+	genesisTime   time.Time
+	slotDuration  time.Duration
+	slotsPerEpoch uint64
+	forkEpochs    map[string]uint64
+}
+
+func NewChainClock(clock Clock, genesisTime time.Time, slotDuration time.Duration, slotsPerEpoch uint64, forkEpochs map[string]uint64) *ChainClock {
+	return &ChainClock{
+		Clock:         clock,
+		genesisTime:   genesisTime,
+		slotDuration:  slotDuration,
+		slotsPerEpoch: slotsPerEpoch,
+		forkEpochs:    forkEpochs,
+	}
+}
+
+// GetChainClock reads the genesis time and chain spec from the service's beacon API.
+func GetChainClock(ctx context.Context, clock Clock, service *services.ServiceContext) (*ChainClock, error) {
+	beaconURL, err := GetBeaconAPIURL(service)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get beacon api url")
+	}
+
+	client := beacon.NewClient(beaconURL)
+	genesis, err := client.Genesis(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get genesis")
+	}
+
+	spec, err := client.Spec(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get spec")
+	}
+
+	log.Info("Retrieved chain clock", "genesis", genesis.GenesisTime.Local().Format(time.DateTime), "slot_duration", spec.SlotDuration, "slots_per_epoch", spec.SlotsPerEpoch)
+	return NewChainClock(clock, genesis.GenesisTime, spec.SlotDuration, spec.SlotsPerEpoch, spec.ForkEpochs), nil
+}
+
+func (c *ChainClock) SlotDuration() time.Duration {
+	return c.slotDuration
+}
+
+func (c *ChainClock) EpochDuration() time.Duration {
+	return c.slotDuration * time.Duration(c.slotsPerEpoch)
+}
+
+// SlotAt returns the slot in progress at t, or zero before genesis.
+func (c *ChainClock) SlotAt(t time.Time) uint64 {
+	if t.Before(c.genesisTime) {
+		return 0
+	}
+	return uint64(t.Sub(c.genesisTime) / c.slotDuration)
+}
+
+// EpochAt returns the epoch in progress at t, or zero before genesis.
+func (c *ChainClock) EpochAt(t time.Time) uint64 {
+	return c.SlotAt(t) / c.slotsPerEpoch
+}
+
+func (c *ChainClock) CurrentSlot() uint64 {
+	return c.SlotAt(c.Now())
+}
+
+func (c *ChainClock) CurrentEpoch() uint64 {
+	return c.EpochAt(c.Now())
+}
+
+// SleepUntil blocks until t, returning immediately if t has already passed. It returns false if ctx
+// is cancelled first.
+func (c *ChainClock) SleepUntil(ctx context.Context, t time.Time) bool {
+	return sleepContext(ctx, c.Clock, t.Sub(c.Now()))
+}
+
+func (c *ChainClock) SlotStart(slot uint64) time.Time {
+	return c.genesisTime.Add(c.slotDuration * time.Duration(slot))
+}
+
+func (c *ChainClock) EpochStart(epoch uint64) time.Time {
+	return c.SlotStart(epoch * c.slotsPerEpoch)
+}
+
+func (c *ChainClock) ForkEpoch(fork string) (uint64, error) {
+	epoch, ok := c.forkEpochs[fork]
+	if !ok {
+		return 0, fmt.Errorf("unknown fork %q", fork)
+	}
+	return epoch, nil
+}
+
+const (
+	// farFutureEpoch is the spec's FAR_FUTURE_EPOCH, the epoch of forks that aren't scheduled.
+	farFutureEpoch = math.MaxUint64
+	// maxForkWait is the longest a test waits for its fork to activate. Anything later is almost
+	// certainly a fork that isn't scheduled in the enclave.
+	maxForkWait = 24 * time.Hour
+)
+
+// stepSchedule aligns test steps to epoch boundaries, starting at the first epoch boundary at which
+// the configured fork is active, or the next one if no fork is configured.
+type stepSchedule struct {
+	chainClock    *ChainClock
+	startEpoch    uint64
+	epochsPerStep uint64
+}
+
+func newStepSchedule(chainClock *ChainClock, fork string, epochsPerStep uint) (*stepSchedule, error) {
+	if epochsPerStep == 0 {
+		return nil, fmt.Errorf("epochs per step must be positive")
+	}
+
+	startEpoch := chainClock.CurrentEpoch() + 1
+	if fork == "" {
+		return &stepSchedule{
+			chainClock:    chainClock,
+			startEpoch:    startEpoch,
+			epochsPerStep: uint64(epochsPerStep),
+		}, nil
+	}
+
+	forkEpoch, err := chainClock.ForkEpoch(fork)
+	if err != nil {
+		return nil, err
+	}
+	if forkEpoch == farFutureEpoch {
+		return nil, fmt.Errorf("fork %q isn't scheduled", fork)
+	}
+
+	if forkEpoch > startEpoch && forkEpoch-startEpoch > uint64(maxForkWait/chainClock.EpochDuration()) {
+		return nil, fmt.Errorf("fork %q activates at epoch %d, more than %s away", fork, forkEpoch, maxForkWait)
+	}
+	if forkEpoch > startEpoch {
+		startEpoch = forkEpoch
+	}
+
+	return &stepSchedule{
+		chainClock:    chainClock,
+		startEpoch:    startEpoch,
+		epochsPerStep: uint64(epochsPerStep),
+	}, nil
+}
+
+// waitForStart blocks until the schedule's first epoch begins, returning false if ctx is cancelled
+// first.
+func (s *stepSchedule) waitForStart(ctx context.Context) bool {
+	start := s.chainClock.EpochStart(s.startEpoch)
+	log.Info("Waiting for the first step", "epoch", s.startEpoch, "start_at", start.Local().Format("15:04:05"))
+	return s.chainClock.SleepUntil(ctx, start)
+}
+
+// elapsedEpochs returns the number of complete epochs since the schedule started.
+func (s *stepSchedule) elapsedEpochs(t time.Time) uint64 {
+	epoch := s.chainClock.EpochAt(t)
+	if epoch < s.startEpoch {
+		return 0
+	}
+	return epoch - s.startEpoch
+}
+
+// stepDue reports whether the step with the given index has run for its full number of epochs.
+func (s *stepSchedule) stepDue(step uint, t time.Time) bool {
+	return s.elapsedEpochs(t) >= (uint64(step)+1)*s.epochsPerStep
+}
+
+// stepEnd returns the time at which the step with the given index ends.
+func (s *stepSchedule) stepEnd(step uint) time.Time {
+	return s.chainClock.EpochStart(s.startEpoch + (uint64(step)+1)*s.epochsPerStep)
+}
@@ -0,0 +1,68 @@
+package tester
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testGenesis = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestChainClock returns a chain of 12s slots and 32-slot epochs, whose clock is at the start of
+// the given epoch.
+func newTestChainClock(epoch uint64, forkEpochs map[string]uint64) (*ChainClock, *FakeClock) {
+	clock := NewFakeClock(testGenesis.Add(time.Duration(epoch) * 32 * 12 * time.Second))
+	return NewChainClock(clock, testGenesis, 12*time.Second, 32, forkEpochs), clock
+}
+
+func TestNewStepScheduleForkEpochs(t *testing.T) {
+	tests := []struct {
+		name      string
+		forkEpoch uint64
+		wantStart uint64
+		wantErr   string
+	}{
+		{name: "active", forkEpoch: 0, wantStart: 11},
+		{name: "soon", forkEpoch: 20, wantStart: 20},
+		{name: "far future", forkEpoch: math.MaxUint64, wantErr: `fork "fulu" isn't scheduled`},
+		{name: "too far ahead", forkEpoch: 100_000, wantErr: `fork "fulu" activates at epoch 100000`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chainClock, _ := newTestChainClock(10, map[string]uint64{"fulu": tt.forkEpoch})
+			schedule, err := newStepSchedule(chainClock, "fulu", 2)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newStepSchedule() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newStepSchedule() error = %v", err)
+			}
+			if schedule.startEpoch != tt.wantStart {
+				t.Errorf("startEpoch = %d, want %d", schedule.startEpoch, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestNewStepScheduleUnknownFork(t *testing.T) {
+	chainClock, _ := newTestChainClock(10, map[string]uint64{"electra": 0})
+	if _, err := newStepSchedule(chainClock, "fulu", 2); err == nil || !strings.Contains(err.Error(), `"fulu"`) {
+		t.Fatalf("newStepSchedule() error = %v, want an error naming the fork", err)
+	}
+}
+
+func TestNewStepScheduleWithoutFork(t *testing.T) {
+	// A Pectra network, where Fulu isn't scheduled.
+	chainClock, _ := newTestChainClock(10, map[string]uint64{"electra": 0, "fulu": math.MaxUint64})
+	schedule, err := newStepSchedule(chainClock, "", 2)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+	if schedule.startEpoch != 11 {
+		t.Errorf("startEpoch = %d, want 11", schedule.startEpoch)
+	}
+}
@@ -0,0 +1,273 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	testerchecks "github.com/niran/blob-benchmarks/tester/checks"
+	"github.com/pkg/errors"
+)
+
+// newCheckRunner sets up the checks against the enclave's Grafana and the service under test's
+// beacon API. The excluded services, which the test shapes or isolates, aren't used as a reference
+// for the chain, but the Grafana checks cover their clients as well as the service under test's.
+// Checks stop listening to the service when ctx is cancelled.
+func newCheckRunner(ctx context.Context, enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext, options TestOptions, excluded []*services.ServiceContext) (checks.Runner, error) {
+	grafanaBaseURL, grafanaToken, datasourceID, err := GetGrafanaConfig(enclaveContext)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get grafana config")
+	}
+
+	beaconURL, err := GetBeaconAPIURL(service)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get beacon api url")
+	}
+
+	promQLChecks, err := testerchecks.LoadPromQLChecks(options.ChecksFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load checks")
+	}
+
+	// Without metrics, only connected peers are compared with the baseline.
+	metricsURL, err := GetMetricsURL(service)
+	if err != nil {
+		log.Warn("Not checking mesh peers or peer scores", "error", err)
+	}
+
+	var consensusClients []string
+	for _, s := range append([]*services.ServiceContext{service}, excluded...) {
+		if client := consensusClient(string(s.GetServiceName())); client != "" && !slices.Contains(consensusClients, client) {
+			consensusClients = append(consensusClients, client)
+		}
+	}
+
+	checkOptions := testerchecks.Options{
+		ConsensusClients: consensusClients,
+		PromQLChecks:     promQLChecks,
+		Node: testerchecks.Node{
+			Name:       string(service.GetServiceName()),
+			BeaconURL:  beaconURL,
+			MetricsURL: metricsURL,
+		},
+		GossipPercentile: options.GossipPercentile,
+		GossipDeadline:   options.GossipDeadline,
+		PeerThresholds: testerchecks.PeerThresholds{
+			MinPeerRatio: options.MinPeerRatio,
+			MinMeshRatio: options.MinMeshRatio,
+			MaxScoreDrop: options.MaxScoreDrop,
+		},
+		Clock: options.clock(),
+	}
+
+	// Blob data is judged against a reference's canonical blocks, and proposals are only checked if
+	// the service's validators are known too.
+	validators := options.Validators
+	if len(validators) == 0 {
+		validators, err = GetValidatorIndices(enclaveContext, service)
+		if err != nil {
+			log.Warn("Not checking proposals: failed to find the service's validators", "service", service.GetServiceName(), "error", err)
+		}
+	}
+	reference, err := GetReferenceService(enclaveContext, service, options.Reference, excluded)
+	if err != nil && len(validators) > 0 {
+		return nil, errors.Wrap(err, "failed to get reference service")
+	} else if err != nil {
+		log.Warn("No reference node, checking blob data against the service's own chain", "service", service.GetServiceName(), "error", err)
+	} else {
+		referenceURL, err := GetBeaconAPIURL(reference)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get reference beacon api url")
+		}
+		checkOptions.Reference = testerchecks.Node{
+			Name:      string(reference.GetServiceName()),
+			BeaconURL: referenceURL,
+		}
+		if len(validators) > 0 {
+			log.Info("Checking proposals against reference", "reference", reference.GetServiceName(), "validators", len(validators))
+			checkOptions.Validators = validators
+		}
+	}
+
+	runner, err := testerchecks.SetupRunner(ctx, grafanaBaseURL, grafanaToken, datasourceID, checkOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to setup runner")
+	}
+	return runner, nil
+}
+
+// maxEvaluateErrors is how many slots in a row the checks may fail to run at the end of a step before
+// the step is failed.
+const maxEvaluateErrors = 5
+
+// StepVerdict records whether a test step passed and which check results decided it.
+type StepVerdict struct {
+	Passed bool `json:"passed"`
+	// FailedChecks are the critical checks that failed for the service under test.
+	FailedChecks []string `json:"failed_checks,omitempty"`
+	// IgnoredChecks failed, but only for other nodes or without being critical.
+	IgnoredChecks []string `json:"ignored_checks,omitempty"`
+	// Error is why the checks couldn't be run, if the step failed because of it.
+	Error string `json:"error,omitempty"`
+}
+
+// CheckEvaluator turns check results into a verdict for the service under test.
+type CheckEvaluator struct {
+	service        *services.ServiceContext
+	criticalChecks map[string]bool
+	// stepErrors counts the slots in a row that EvaluateStep failed to run the checks.
+	stepErrors int
+}
+
+// NewCheckEvaluator creates a CheckEvaluator. If no critical checks are given, every check is
+// critical.
+func NewCheckEvaluator(service *services.ServiceContext, criticalChecks []string) *CheckEvaluator {
+	critical := make(map[string]bool, len(criticalChecks))
+	for _, name := range criticalChecks {
+		critical[name] = true
+	}
+
+	return &CheckEvaluator{
+		service:        service,
+		criticalChecks: critical,
+	}
+}
+
+func (e *CheckEvaluator) isCritical(result *checks.Result) bool {
+	return len(e.criticalChecks) == 0 || e.criticalChecks[result.Name]
+}
+
+// affectsServices reports whether a failing result implicates any of the services. Results that
+// don't name any nodes are treated as network-wide failures.
+func affectsServices(result *checks.Result, services []*services.ServiceContext) bool {
+	if len(result.AffectedNodes) == 0 {
+		return true
+	}
+
+	for _, node := range result.AffectedNodes {
+		for _, service := range services {
+			if nodeMatchesService(node, service) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Evaluate runs every registered check and decides whether the step passed.
+func (e *CheckEvaluator) Evaluate(ctx context.Context, runner checks.Runner) (StepVerdict, error) {
+	if err := runner.RunChecks(ctx); err != nil {
+		return StepVerdict{}, err
+	}
+
+	log.Info("Check results", "results", runner.GetResults())
+	log.Info("Check analysis", "analysis", runner.GetAnalysis())
+	// log.Info("Check logs", "logs", runner.GetLog().GetBuffer().String())
+
+	verdict := e.evaluateResults(runner.GetResults(), []*services.ServiceContext{e.service})
+	if !verdict.Passed {
+		log.Info("Checks failed for service under test", "service", e.service.GetServiceName(), "failed_checks", verdict.FailedChecks)
+	} else if len(verdict.IgnoredChecks) > 0 {
+		log.Info("Ignoring failed checks", "ignored_checks", verdict.IgnoredChecks)
+	}
+
+	return verdict, nil
+}
+
+// EvaluateStep runs the checks at the end of a step. If they fail to run, it returns false so that
+// they're retried on the next slot, until they've failed maxEvaluateErrors times in a row and the
+// step fails instead.
+func (e *CheckEvaluator) EvaluateStep(ctx context.Context, runner checks.Runner) (StepVerdict, bool) {
+	verdict, err := e.Evaluate(ctx, runner)
+	if err == nil {
+		e.stepErrors = 0
+		return verdict, true
+	}
+
+	e.stepErrors++
+	log.Error("Failed to run checks", "attempt", e.stepErrors, "error", err)
+	if e.stepErrors < maxEvaluateErrors {
+		return StepVerdict{}, false
+	}
+	e.stepErrors = 0
+	return StepVerdict{Error: err.Error()}, true
+}
+
+// EvaluateServices decides whether the results of the last Evaluate pass for a set of services
+// rather than the service under test, without running the checks again.
+func (e *CheckEvaluator) EvaluateServices(runner checks.Runner, services []*services.ServiceContext) StepVerdict {
+	return e.evaluateResults(runner.GetResults(), services)
+}
+
+func (e *CheckEvaluator) evaluateResults(results []*checks.Result, services []*services.ServiceContext) StepVerdict {
+	verdict := StepVerdict{Passed: true}
+	for _, result := range results {
+		if result.Status != checks.StatusFail {
+			continue
+		}
+
+		if e.isCritical(result) && affectsServices(result, services) {
+			verdict.FailedChecks = append(verdict.FailedChecks, result.Name)
+		} else {
+			verdict.IgnoredChecks = append(verdict.IgnoredChecks, result.Name)
+		}
+	}
+
+	sort.Strings(verdict.FailedChecks)
+	sort.Strings(verdict.IgnoredChecks)
+	verdict.Passed = len(verdict.FailedChecks) == 0
+	return verdict
+}
+
+// nodeMatchesService reports whether a node reported by a check refers to the service, either by
+// name, by address, or as another service of the same participant (e.g. el-1-geth-prysm for
+// cl-1-prysm-geth).
+func nodeMatchesService(node string, service *services.ServiceContext) bool {
+	serviceName := string(service.GetServiceName())
+	if strings.Contains(node, serviceName) {
+		return true
+	}
+
+	host := node
+	if h, _, err := net.SplitHostPort(node); err == nil {
+		host = h
+	}
+	if host == service.GetPrivateIPAddress() {
+		return true
+	}
+
+	participant := participantKey(serviceName)
+	return participant != "" && participantKey(node) == participant
+}
+
+// consensusClient returns the name of the consensus client in a service name, such as prysm in
+// cl-1-prysm-geth or el-1-geth-prysm, or "" if it doesn't have one.
+func consensusClient(serviceName string) string {
+	parts := strings.Split(serviceName, "-")
+	if len(parts) < 4 {
+		return ""
+	}
+	if parts[0] == "cl" {
+		return parts[2]
+	}
+	return parts[len(parts)-1]
+}
+
+// participantKey identifies the ethereum-package participant that a service belongs to, ignoring the
+// service's role and the order of its client names.
+func participantKey(serviceName string) string {
+	parts := strings.Split(serviceName, "-")
+	if len(parts) < 4 {
+		return ""
+	}
+
+	clientNames := append([]string{}, parts[2:]...)
+	sort.Strings(clientNames)
+	return parts[1] + "-" + strings.Join(clientNames, "-")
+}
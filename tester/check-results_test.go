@@ -0,0 +1,162 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+func TestConsensusClient(t *testing.T) {
+	tests := []struct {
+		serviceName string
+		want        string
+	}{
+		{"cl-1-prysm-geth", "prysm"},
+		{"cl-2-lighthouse-nethermind", "lighthouse"},
+		{"el-3-geth-teku", "teku"},
+		{"vc-4-besu-lodestar", "lodestar"},
+		{"grafana", ""},
+	}
+	for _, tt := range tests {
+		if got := consensusClient(tt.serviceName); got != tt.want {
+			t.Errorf("consensusClient(%q) = %q, want %q", tt.serviceName, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateResults(t *testing.T) {
+	service := newTestService()
+	failing := func(name string, nodes ...string) *checks.Result {
+		return &checks.Result{Name: name, Status: checks.StatusFail, AffectedNodes: nodes}
+	}
+
+	tests := []struct {
+		name           string
+		criticalChecks []string
+		results        []*checks.Result
+		wantPassed     bool
+		wantFailed     []string
+		wantIgnored    []string
+	}{
+		{
+			name:       "passing results",
+			results:    []*checks.Result{{Name: "Head slot", Status: checks.StatusOK}},
+			wantPassed: true,
+		},
+		{
+			name:       "by name",
+			results:    []*checks.Result{failing("Head slot", "cl-1-prysm-geth")},
+			wantFailed: []string{"Head slot"},
+		},
+		{
+			name:        "other node",
+			results:     []*checks.Result{failing("Head slot", "cl-2-lighthouse-geth")},
+			wantPassed:  true,
+			wantIgnored: []string{"Head slot"},
+		},
+		{
+			name:           "not critical",
+			criticalChecks: []string{"CL sync"},
+			results:        []*checks.Result{failing("Head slot", "cl-1-prysm-geth"), failing("CL sync", "cl-1-prysm-geth")},
+			wantFailed:     []string{"CL sync"},
+			wantIgnored:    []string{"Head slot"},
+		},
+		{
+			name:       "network-wide",
+			results:    []*checks.Result{failing("Finalized epoch")},
+			wantFailed: []string{"Finalized epoch"},
+		},
+		{
+			name:       "by ip and port",
+			results:    []*checks.Result{failing("EL sync", "10.0.0.2:8545", "10.0.0.1:8545")},
+			wantFailed: []string{"EL sync"},
+		},
+		{
+			name:        "other ip",
+			results:     []*checks.Result{failing("EL sync", "10.0.0.10:8545")},
+			wantPassed:  true,
+			wantIgnored: []string{"EL sync"},
+		},
+		{
+			name:       "same participant",
+			results:    []*checks.Result{failing("Validators failing attestations", "vc-1-prysm-geth"), failing("EL block height", "el-1-geth-prysm")},
+			wantFailed: []string{"EL block height", "Validators failing attestations"},
+		},
+		{
+			name:        "other participant",
+			results:     []*checks.Result{failing("Validators failing attestations", "vc-2-prysm-geth")},
+			wantPassed:  true,
+			wantIgnored: []string{"Validators failing attestations"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator := NewCheckEvaluator(service, tt.criticalChecks)
+			verdict := evaluator.evaluateResults(tt.results, []*services.ServiceContext{service})
+
+			if verdict.Passed != tt.wantPassed {
+				t.Errorf("Passed = %v, want %v", verdict.Passed, tt.wantPassed)
+			}
+			if !slices.Equal(verdict.FailedChecks, tt.wantFailed) {
+				t.Errorf("FailedChecks = %v, want %v", verdict.FailedChecks, tt.wantFailed)
+			}
+			if !slices.Equal(verdict.IgnoredChecks, tt.wantIgnored) {
+				t.Errorf("IgnoredChecks = %v, want %v", verdict.IgnoredChecks, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestEvaluateStepFailsAfterRepeatedErrors(t *testing.T) {
+	evaluator := NewCheckEvaluator(newTestService(), nil)
+	runner := &fakeCheckRunner{err: errors.New("node didn't answer")}
+
+	for attempt := 1; attempt < maxEvaluateErrors; attempt++ {
+		if _, ok := evaluator.EvaluateStep(context.Background(), runner); ok {
+			t.Fatalf("EvaluateStep() attempt %d ok = true, want retry", attempt)
+		}
+	}
+	verdict, ok := evaluator.EvaluateStep(context.Background(), runner)
+	if !ok || verdict.Passed || verdict.Error == "" {
+		t.Fatalf("EvaluateStep() after %d errors = %+v, %v, want a failing step", maxEvaluateErrors, verdict, ok)
+	}
+
+	// A successful run resets the count, so the next error is retried again.
+	runner.err = nil
+	runner.passes = func() bool { return true }
+	if verdict, ok := evaluator.EvaluateStep(context.Background(), runner); !ok || !verdict.Passed {
+		t.Fatalf("EvaluateStep() = %+v, %v, want a passing step", verdict, ok)
+	}
+	runner.err = errors.New("node didn't answer")
+	if _, ok := evaluator.EvaluateStep(context.Background(), runner); ok {
+		t.Error("EvaluateStep() after a successful run ok = true, want retry")
+	}
+}
+
+func TestNodeMatchesService(t *testing.T) {
+	service := newTestService()
+	tests := []struct {
+		node string
+		want bool
+	}{
+		{"cl-1-prysm-geth", true},
+		{"cl-1-prysm-geth-validator", true},
+		{"vc-1-prysm-geth", true},
+		{"el-1-geth-prysm", true},
+		{"10.0.0.1", true},
+		{"10.0.0.1:5054", true},
+		{"10.0.0.11:5054", false},
+		{"cl-11-prysm-geth", false},
+		{"cl-2-lighthouse-geth", false},
+		{"grafana", false},
+	}
+	for _, tt := range tests {
+		if got := nodeMatchesService(tt.node, service); got != tt.want {
+			t.Errorf("nodeMatchesService(%q) = %v, want %v", tt.node, got, tt.want)
+		}
+	}
+}
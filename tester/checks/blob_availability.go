@@ -0,0 +1,263 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/clients"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+const (
+	// blobAvailabilitySlots is how many recent slots are checked, i.e. about one epoch.
+	blobAvailabilitySlots = 32
+	// blobLateSlots is how long after its slot a block's data is reported as late rather than
+	// missing. Late data doesn't fail the check. The current slot itself is skipped because its data
+	// may still be arriving.
+	blobLateSlots = 2
+)
+
+// BlobAvailabilityCheck is a check that verifies that a node has the blob sidecars, or from Fulu its
+// custody data columns, for the canonical blocks of recent slots. Slots are counted by wall-clock
+// time rather than from the node's head, so a stalled node doesn't hide the slots it fell behind on.
+// If a reference node is given, its canonical blocks are the ones the node must have.
+type BlobAvailabilityCheck struct {
+	node      Node
+	client    *beacon.Client
+	reference *beacon.Client
+	// unsupported maps the kinds of sidecars whose endpoint the node doesn't serve to true.
+	unsupported map[string]bool
+}
+
+// NewBlobAvailabilityCheck creates a new BlobAvailabilityCheck. The reference is optional; without
+// it, the node's own canonical blocks are checked. The node is asked for the sidecars of its head
+// block to find out which sidecar endpoints it serves.
+func NewBlobAvailabilityCheck(ctx context.Context, node Node, reference Node) *BlobAvailabilityCheck {
+	c := &BlobAvailabilityCheck{
+		node:        node,
+		client:      beacon.NewClient(node.BeaconURL),
+		unsupported: make(map[string]bool),
+	}
+	c.reference = c.client
+	if reference.BeaconURL != "" {
+		c.reference = beacon.NewClient(reference.BeaconURL)
+	}
+	c.probe(ctx)
+	return c
+}
+
+// probe records which sidecar endpoints the node doesn't serve. The node always has its head block,
+// so a 404 for its sidecars means the endpoint is missing. Any other failure leaves the endpoint
+// assumed to be served.
+func (c *BlobAvailabilityCheck) probe(ctx context.Context) {
+	for kind, indices := range map[string]func(context.Context, string) ([]uint64, error){
+		"blob sidecars": c.client.BlobSidecarIndices,
+		"data columns":  c.client.DataColumnSidecarIndices,
+	} {
+		_, err := indices(ctx, "head")
+		if errors.Is(err, beacon.ErrNotFound) {
+			gethlog.Info("Node doesn't serve sidecars, not checking them", "node", c.node.Name, "sidecars", kind)
+			c.unsupported[kind] = true
+		} else if err != nil {
+			gethlog.Warn("Failed to find out whether node serves sidecars", "node", c.node.Name, "sidecars", kind, "error", err)
+		}
+	}
+}
+
+// Name returns the name of the check.
+func (c *BlobAvailabilityCheck) Name() string {
+	return "Blob data availability"
+}
+
+// Category returns the category of the check.
+func (c *BlobAvailabilityCheck) Category() checks.Category {
+	return checks.CategorySync
+}
+
+// ClientType returns the client type of the check.
+func (c *BlobAvailabilityCheck) ClientType() clients.ClientType {
+	return clients.ClientTypeCL
+}
+
+// custodyColumns returns the number of data columns the node custodies, or zero if Fulu isn't active
+// at the slot.
+func (c *BlobAvailabilityCheck) custodyColumns(ctx context.Context, spec *beacon.Spec, slot uint64) (int, error) {
+	fuluEpoch, ok := spec.ForkEpochs["fulu"]
+	if !ok || slot/spec.SlotsPerEpoch < fuluEpoch {
+		return 0, nil
+	}
+	if spec.NumberOfCustodyGroups == 0 {
+		return 0, fmt.Errorf("spec is missing NUMBER_OF_CUSTODY_GROUPS")
+	}
+
+	custodyGroups, err := c.client.CustodyGroupCount(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get custody group count")
+	}
+	return int(custodyGroups * spec.NumberOfColumns / spec.NumberOfCustodyGroups), nil
+}
+
+// Run executes the check.
+func (c *BlobAvailabilityCheck) Run(ctx context.Context, log *logger.CheckLogger, cfg checks.Config) (*checks.Result, error) {
+	log.Print("\n=== Running blob data availability check")
+
+	spec, err := c.reference.Spec(ctx)
+	if err != nil {
+		return c.referenceFailure(log, errors.Wrap(err, "failed to get spec"))
+	}
+	genesis, err := c.reference.Genesis(ctx)
+	if err != nil {
+		return c.referenceFailure(log, errors.Wrap(err, "failed to get genesis"))
+	}
+	elapsed := time.Since(genesis.GenesisTime)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	currentSlot := uint64(elapsed / spec.SlotDuration)
+	custodyColumns, err := c.custodyColumns(ctx, spec, currentSlot)
+	if err != nil {
+		return nodeFailure(c, log, c.node, err), nil
+	}
+	fuluEpoch, fulu := spec.ForkEpochs["fulu"]
+
+	var problems []string
+	var late, missing, checked int
+	var skipped string
+	for offset := uint64(1); offset <= blobAvailabilitySlots && offset <= currentSlot; offset++ {
+		slot := currentSlot - offset
+		blockID := strconv.FormatUint(slot, 10)
+
+		header, err := c.reference.BlockHeader(ctx, blockID)
+		if errors.Is(err, beacon.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return c.referenceFailure(log, errors.Wrapf(err, "failed to get block at slot %d", slot))
+		}
+		if !header.Canonical {
+			continue
+		}
+
+		blobCount, err := c.reference.BlobCount(ctx, header.Root)
+		if err != nil {
+			return c.referenceFailure(log, errors.Wrapf(err, "failed to get blob count for slot %d", slot))
+		}
+		if blobCount == 0 {
+			continue
+		}
+
+		// From Fulu, nodes only receive the columns they custody rather than every blob.
+		kind := "blob sidecars"
+		expected := blobCount
+		if fulu && slot/spec.SlotsPerEpoch >= fuluEpoch {
+			kind = "data columns"
+			expected = custodyColumns
+		}
+
+		if c.unsupported[kind] {
+			skipped = kind
+			continue
+		}
+
+		// A node without the block can't have its data, and one that serves the sidecars but
+		// doesn't find them for the block is missing them.
+		var indices []uint64
+		_, err = c.client.BlockHeader(ctx, header.Root)
+		if err == nil {
+			if kind == "data columns" {
+				indices, err = c.client.DataColumnSidecarIndices(ctx, header.Root)
+			} else {
+				indices, err = c.client.BlobSidecarIndices(ctx, header.Root)
+			}
+		}
+		if err != nil && !errors.Is(err, beacon.ErrNotFound) {
+			return nodeFailure(c, log, c.node, errors.Wrapf(err, "failed to get %s for slot %d", kind, slot)), nil
+		}
+		checked++
+
+		if len(indices) >= expected {
+			continue
+		}
+
+		state := "missing"
+		if offset <= blobLateSlots {
+			state = "late"
+			late++
+		} else {
+			missing++
+		}
+		problem := fmt.Sprintf("slot %d: %d of %d %s %s", slot, expected-len(indices), expected, kind, state)
+		problems = append(problems, problem)
+		log.Printf("  - %s", problem)
+	}
+
+	if checked == 0 && skipped != "" {
+		return c.skipped(log, skipped), nil
+	}
+
+	details := map[string]interface{}{
+		"currentSlot":   currentSlot,
+		"checkedBlocks": checked,
+		"lateBlocks":    late,
+	}
+	if len(problems) > 0 {
+		details["problems"] = strings.Join(problems, "\n")
+	}
+
+	if missing == 0 {
+		log.Printf("  - No data is missing for %d recent blocks with blobs, %d late", checked, late)
+
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   "Blob data is available for recent blocks",
+			Timestamp:     time.Now(),
+			Details:       details,
+			AffectedNodes: []string{},
+		}, nil
+	}
+
+	details["missingBlocks"] = missing
+
+	return &checks.Result{
+		Name:          c.Name(),
+		Category:      c.Category(),
+		Status:        checks.StatusFail,
+		Description:   fmt.Sprintf("Blob data is missing for %d and late for %d of %d recent blocks", missing, late, checked),
+		Timestamp:     time.Now(),
+		Details:       details,
+		AffectedNodes: []string{c.node.Name},
+	}, nil
+}
+
+// referenceFailure returns the error of a query to the reference, unless the node is its own
+// reference, in which case the node fails.
+func (c *BlobAvailabilityCheck) referenceFailure(log *logger.CheckLogger, err error) (*checks.Result, error) {
+	if c.reference == c.client {
+		return nodeFailure(c, log, c.node, err), nil
+	}
+	return nil, err
+}
+
+// skipped returns the result for a node that doesn't serve the sidecars the check needs. It passes,
+// since the node's data availability can't be judged.
+func (c *BlobAvailabilityCheck) skipped(log *logger.CheckLogger, kind string) *checks.Result {
+	log.Printf("  - %s doesn't serve %s, skipping", c.node.Name, kind)
+
+	return &checks.Result{
+		Name:          c.Name(),
+		Category:      c.Category(),
+		Status:        checks.StatusOK,
+		Description:   fmt.Sprintf("Skipped: the node doesn't serve %s", kind),
+		Timestamp:     time.Now(),
+		Details:       map[string]interface{}{"unsupported": kind},
+		AffectedNodes: []string{},
+	}
+}
@@ -0,0 +1,138 @@
+package checks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+)
+
+// atSlot sets the beacon's genesis so that the wall clock is halfway through slot.
+func atSlot(b *fakeBeacon, slot uint64) *fakeBeacon {
+	b.genesis = time.Now().Add(-time.Duration(slot)*12*time.Second - 6*time.Second)
+	return b
+}
+
+func TestBlobAvailability(t *testing.T) {
+	fulu := func(b *fakeBeacon) *fakeBeacon {
+		// Fulu activates at slot 96, and the node custodies 4 of the 128 columns.
+		b.spec["FULU_FORK_EPOCH"] = "3"
+		b.spec["NUMBER_OF_COLUMNS"] = "128"
+		b.spec["NUMBER_OF_CUSTODY_GROUPS"] = "128"
+		b.custodyGroups = 4
+		return b
+	}
+
+	tests := []struct {
+		name string
+		// node is the beacon under test, and reference, if set, the one whose canonical blocks the
+		// node must have.
+		node         *fakeBeacon
+		reference    *fakeBeacon
+		wantStatus   checks.Status
+		wantDetails  map[string]interface{}
+		wantProblems []string
+	}{
+		{
+			name: "late and missing",
+			node: atSlot(newFakeBeacon(
+				fakeBlock{slot: 99, root: "0x99", canonical: true, blobs: 2, sidecars: []uint64{0}},
+				fakeBlock{slot: 98, root: "0x98", canonical: true, blobs: 1},
+				fakeBlock{slot: 97, root: "0x97", canonical: true, blobs: 3, sidecars: []uint64{0, 1}},
+				fakeBlock{slot: 96, root: "0x96", canonical: true, blobs: 2, sidecars: []uint64{0, 1}},
+				fakeBlock{slot: 95, root: "0x95", canonical: true},
+			), 100),
+			wantStatus:  checks.StatusFail,
+			wantDetails: map[string]interface{}{"currentSlot": uint64(100), "checkedBlocks": 4, "lateBlocks": 2, "missingBlocks": 1},
+			wantProblems: []string{
+				"slot 99: 1 of 2 blob sidecars late",
+				"slot 98: 1 of 1 blob sidecars late",
+				"slot 97: 1 of 3 blob sidecars missing",
+			},
+		},
+		{
+			name: "only late",
+			node: atSlot(newFakeBeacon(
+				fakeBlock{slot: 99, root: "0x99", canonical: true, blobs: 2},
+				fakeBlock{slot: 96, root: "0x96", canonical: true, blobs: 2, sidecars: []uint64{0, 1}},
+			), 100),
+			wantStatus:   checks.StatusOK,
+			wantDetails:  map[string]interface{}{"checkedBlocks": 2, "lateBlocks": 1},
+			wantProblems: []string{"slot 99: 2 of 2 blob sidecars late"},
+		},
+		{
+			// The node stalled at slot 80, so the reference's later blocks count against it even
+			// though they're past the node's head.
+			name: "stalled node",
+			node: atSlot(newFakeBeacon(
+				fakeBlock{slot: 80, root: "0x80", canonical: true, blobs: 1, sidecars: []uint64{0}},
+			), 100),
+			reference: atSlot(newFakeBeacon(
+				fakeBlock{slot: 90, root: "0x90", canonical: true, blobs: 2},
+				fakeBlock{slot: 80, root: "0x80", canonical: true, blobs: 1},
+				fakeBlock{slot: 60, root: "0x60", canonical: true, blobs: 1},
+			), 100),
+			wantStatus:   checks.StatusFail,
+			wantDetails:  map[string]interface{}{"currentSlot": uint64(100), "checkedBlocks": 2, "missingBlocks": 1},
+			wantProblems: []string{"slot 90: 2 of 2 blob sidecars missing"},
+		},
+		{
+			name: "early chain",
+			node: atSlot(newFakeBeacon(
+				fakeBlock{slot: 0, root: "0x00", canonical: true},
+				fakeBlock{slot: 3, root: "0x03", canonical: true, blobs: 1, sidecars: []uint64{0}},
+			), 5),
+			wantStatus:  checks.StatusOK,
+			wantDetails: map[string]interface{}{"currentSlot": uint64(5), "checkedBlocks": 1, "lateBlocks": 0},
+		},
+		{
+			name: "blob sidecars before Fulu and data columns after",
+			node: atSlot(fulu(newFakeBeacon(
+				fakeBlock{slot: 99, root: "0x99", canonical: true},
+				fakeBlock{slot: 97, root: "0x97", canonical: true, blobs: 2, columns: []uint64{0, 1, 2, 3}},
+				fakeBlock{slot: 96, root: "0x96", canonical: true, blobs: 1, columns: []uint64{0, 1}},
+				fakeBlock{slot: 95, root: "0x95", canonical: true, blobs: 2, sidecars: []uint64{0, 1}},
+				fakeBlock{slot: 94, root: "0x94", canonical: true, blobs: 2, columns: []uint64{0, 1, 2, 3}},
+			)), 100),
+			wantStatus:   checks.StatusFail,
+			wantDetails:  map[string]interface{}{"checkedBlocks": 4, "missingBlocks": 2},
+			wantProblems: []string{"slot 96: 2 of 4 data columns missing", "slot 94: 2 of 2 blob sidecars missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node.start()
+			defer node.Close()
+			var reference Node
+			if tt.reference != nil {
+				server := tt.reference.start()
+				defer server.Close()
+				reference.BeaconURL = server.URL
+			}
+
+			c := NewBlobAvailabilityCheck(context.Background(), Node{Name: "cl-1", BeaconURL: node.URL}, reference)
+			result, err := c.Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s: %s", result.Status, tt.wantStatus, result.Description)
+			}
+			for key, want := range tt.wantDetails {
+				if got := result.Details[key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+			var problems []string
+			if details, ok := result.Details["problems"].(string); ok {
+				problems = strings.Split(details, "\n")
+			}
+			if strings.Join(problems, "\n") != strings.Join(tt.wantProblems, "\n") {
+				t.Errorf("problems = %q, want %q", problems, tt.wantProblems)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeBlock is a block served by a fakeBeacon.
+type fakeBlock struct {
+	slot      uint64
+	root      string
+	proposer  uint64
+	canonical bool
+	blobs     int
+	// sidecars and columns are the indices of the blob sidecars and data columns the node has for
+	// the block.
+	sidecars []uint64
+	columns  []uint64
+}
+
+// fakeBeacon serves the parts of the beacon API the checks use from a list of blocks. Endpoints
+// whose fail field is set answer with that status instead.
+type fakeBeacon struct {
+	mu      sync.Mutex
+	genesis time.Time
+	spec    map[string]string
+	blocks  []fakeBlock
+	// duties maps slots to the validator due to propose at them.
+	duties        map[uint64]uint64
+	custodyGroups uint64
+	fail          map[string]int
+}
+
+func newFakeBeacon(blocks ...fakeBlock) *fakeBeacon {
+	return &fakeBeacon{
+		genesis: time.Unix(1_700_000_000, 0),
+		spec:    map[string]string{"SECONDS_PER_SLOT": "12", "SLOTS_PER_EPOCH": "32"},
+		blocks:  blocks,
+		duties:  make(map[uint64]uint64),
+		fail:    make(map[string]int),
+	}
+}
+
+// start serves the node until the returned server is closed.
+func (b *fakeBeacon) start() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(b.serve))
+}
+
+// block returns the block with the given ID: "head", a slot, whose block must be canonical, or a
+// root.
+func (b *fakeBeacon) block(id string) *fakeBlock {
+	var found *fakeBlock
+	for i := range b.blocks {
+		block := &b.blocks[i]
+		switch {
+		case id == "head":
+			if block.canonical && (found == nil || block.slot > found.slot) {
+				found = block
+			}
+		case id == strconv.FormatUint(block.slot, 10):
+			if block.canonical {
+				found = block
+			}
+		case id == block.root:
+			found = block
+		}
+	}
+	return found
+}
+
+func (b *fakeBeacon) serve(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for prefix, status := range b.fail {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			http.Error(w, "failing", status)
+			return
+		}
+	}
+
+	path, id := r.URL.Path, ""
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path, id = path[:i+1], path[i+1:]
+	}
+
+	var data interface{}
+	switch {
+	case r.URL.Path == "/eth/v1/config/spec":
+		data = b.spec
+	case r.URL.Path == "/eth/v1/beacon/genesis":
+		data = map[string]string{"genesis_time": strconv.FormatInt(b.genesis.Unix(), 10)}
+	case r.URL.Path == "/eth/v1/node/identity":
+		data = map[string]interface{}{"metadata": map[string]string{"custody_group_count": strconv.FormatUint(b.custodyGroups, 10)}}
+	case r.URL.Path == "/eth/v1/beacon/headers":
+		headers := []interface{}{}
+		for _, block := range b.blocks {
+			if strconv.FormatUint(block.slot, 10) == r.URL.Query().Get("slot") {
+				headers = append(headers, header(block))
+			}
+		}
+		data = headers
+	case path == "/eth/v1/validator/duties/proposer/":
+		epoch, _ := strconv.ParseUint(id, 10, 64)
+		slotsPerEpoch, _ := strconv.ParseUint(b.spec["SLOTS_PER_EPOCH"], 10, 64)
+		duties := []interface{}{}
+		for slot := epoch * slotsPerEpoch; slot < (epoch+1)*slotsPerEpoch; slot++ {
+			if validator, ok := b.duties[slot]; ok {
+				duties = append(duties, map[string]string{"slot": strconv.FormatUint(slot, 10), "validator_index": strconv.FormatUint(validator, 10)})
+			}
+		}
+		data = duties
+	default:
+		block := b.block(id)
+		if block == nil {
+			http.NotFound(w, r)
+			return
+		}
+		switch path {
+		case "/eth/v1/beacon/headers/":
+			data = header(*block)
+		case "/eth/v2/beacon/blocks/":
+			commitments := make([]string, block.blobs)
+			for i := range commitments {
+				commitments[i] = fmt.Sprintf("0x%02x", i)
+			}
+			data = map[string]interface{}{"message": map[string]interface{}{"body": map[string]interface{}{"blob_kzg_commitments": commitments}}}
+		case "/eth/v1/beacon/blob_sidecars/":
+			data = sidecars(block.sidecars)
+		case "/eth/v1/debug/beacon/data_column_sidecars/":
+			data = sidecars(block.columns)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func header(block fakeBlock) map[string]interface{} {
+	return map[string]interface{}{
+		"root":      block.root,
+		"canonical": block.canonical,
+		"header": map[string]interface{}{"message": map[string]string{
+			"slot":           strconv.FormatUint(block.slot, 10),
+			"proposer_index": strconv.FormatUint(block.proposer, 10),
+			"parent_root":    "0x00",
+		}},
+	}
+}
+
+func sidecars(indices []uint64) []interface{} {
+	data := []interface{}{}
+	for _, index := range indices {
+		data = append(data, map[string]string{"index": strconv.FormatUint(index, 10)})
+	}
+	return data
+}
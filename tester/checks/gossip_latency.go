@@ -0,0 +1,313 @@
+package checks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/clients"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultGossipPercentile is the arrival percentile compared with the deadline.
+	DefaultGossipPercentile = 95
+
+	gossipKindBlock  = "block"
+	gossipKindBlobs  = "blobs"
+	gossipKindColumn = "data columns"
+
+	// gossipRetryInterval is how long the listener waits before retrying the node's API or event
+	// stream.
+	gossipRetryInterval = 5 * time.Second
+)
+
+// Clock paces the listener's retries, so that tests don't have to wait for them. The tester's clocks
+// satisfy it.
+type Clock interface {
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// gossipTopics maps the event topics the check subscribes to onto what they measure. block_gossip
+// fires once a block passes gossip validation, which is earlier than block on the clients that
+// support it.
+var gossipTopics = map[string]string{
+	"block_gossip":        gossipKindBlock,
+	"block":               gossipKindBlock,
+	"blob_sidecar":        gossipKindBlobs,
+	"data_column_sidecar": gossipKindColumn,
+}
+
+// gossipArrival is when a block, or the last of its sidecars of one kind, arrived.
+type gossipArrival struct {
+	slot  uint64
+	delay time.Duration
+}
+
+// GossipLatencyCheck is a check that verifies that a node receives blocks, blob sidecars and data
+// column sidecars early enough in their slot to attest to them. It listens to the node's event
+// stream in the background and judges the arrivals since it last ran. If the reference's head moved
+// on since then but no blocks arrived, the node is failing to receive them at all.
+type GossipLatencyCheck struct {
+	node       Node
+	client     *beacon.Client
+	reference  *beacon.Client
+	percentile float64
+	deadline   time.Duration
+	clock      Clock
+
+	mu           sync.Mutex
+	genesis      time.Time
+	slotDuration time.Duration
+	arrivals     map[string]map[string]gossipArrival
+	// lastHead is the reference's head slot when the check last ran, or zero before the first run.
+	lastHead uint64
+}
+
+// NewGossipLatencyCheck creates a new GossipLatencyCheck and starts listening to the node until ctx
+// is cancelled. The reference is optional; without it, the node's own head is used. A zero
+// percentile uses DefaultGossipPercentile, a zero deadline uses the attestation deadline, a third
+// of the way into the slot, and a nil clock uses the real one.
+func NewGossipLatencyCheck(ctx context.Context, node Node, reference Node, percentile float64, deadline time.Duration, clock Clock) *GossipLatencyCheck {
+	if percentile == 0 {
+		percentile = DefaultGossipPercentile
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	c := &GossipLatencyCheck{
+		node:       node,
+		client:     beacon.NewClient(node.BeaconURL),
+		percentile: percentile,
+		deadline:   deadline,
+		clock:      clock,
+		arrivals:   make(map[string]map[string]gossipArrival),
+	}
+	c.reference = c.client
+	if reference.BeaconURL != "" {
+		c.reference = beacon.NewClient(reference.BeaconURL)
+	}
+	go c.listen(ctx)
+	return c
+}
+
+// sleep waits for d on the check's clock, returning false if ctx is cancelled first.
+func (c *GossipLatencyCheck) sleep(ctx context.Context, d time.Duration) bool {
+	slept := make(chan struct{})
+	go func() {
+		c.clock.Sleep(d)
+		close(slept)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-slept:
+		return true
+	}
+}
+
+// Name returns the name of the check.
+func (c *GossipLatencyCheck) Name() string {
+	return "Gossip arrival latency"
+}
+
+// Category returns the category of the check.
+func (c *GossipLatencyCheck) Category() checks.Category {
+	return checks.CategoryGeneral
+}
+
+// ClientType returns the client type of the check.
+func (c *GossipLatencyCheck) ClientType() clients.ClientType {
+	return clients.ClientTypeCL
+}
+
+// listen reads the chain timing, then subscribes to each topic separately so that a topic the client
+// doesn't support doesn't stop the others.
+func (c *GossipLatencyCheck) listen(ctx context.Context) {
+	for {
+		genesis, err := c.client.Genesis(ctx)
+		if err == nil {
+			var spec *beacon.Spec
+			spec, err = c.client.Spec(ctx)
+			if err == nil {
+				c.mu.Lock()
+				c.genesis = genesis.GenesisTime
+				c.slotDuration = spec.SlotDuration
+				c.mu.Unlock()
+				break
+			}
+		}
+		gethlog.Debug("Failed to get chain timing for gossip latency check", "node", c.node.Name, "error", err)
+		if !c.sleep(ctx, gossipRetryInterval) {
+			return
+		}
+	}
+
+	for topic := range gossipTopics {
+		go func() {
+			for {
+				err := c.client.SubscribeEvents(ctx, []string{topic}, c.record)
+				if errors.Is(err, beacon.ErrUnsupportedTopic) {
+					gethlog.Info("Node doesn't support event topic", "node", c.node.Name, "topic", topic)
+					return
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				gethlog.Debug("Event stream ended, reconnecting", "node", c.node.Name, "topic", topic, "error", err)
+				if !c.sleep(ctx, gossipRetryInterval) {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// record keeps the earliest arrival of each block and the latest arrival of each block's sidecars,
+// i.e. when all of the sidecars the node receives for it were in.
+func (c *GossipLatencyCheck) record(event beacon.Event) {
+	var data struct {
+		Slot      string `json:"slot"`
+		Block     string `json:"block"`
+		BlockRoot string `json:"block_root"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		gethlog.Debug("Failed to decode event", "topic", event.Topic, "error", err)
+		return
+	}
+	slot, err := strconv.ParseUint(data.Slot, 10, 64)
+	if err != nil {
+		return
+	}
+	root := data.BlockRoot
+	if root == "" {
+		root = data.Block
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kind := gossipTopics[event.Topic]
+	slotStart := c.genesis.Add(time.Duration(slot) * c.slotDuration)
+	arrival := gossipArrival{slot: slot, delay: event.Received.Sub(slotStart)}
+
+	if c.arrivals[kind] == nil {
+		c.arrivals[kind] = make(map[string]gossipArrival)
+	}
+	previous, seen := c.arrivals[kind][root]
+	if !seen || (kind == gossipKindBlock && arrival.delay < previous.delay) || (kind != gossipKindBlock && arrival.delay > previous.delay) {
+		c.arrivals[kind][root] = arrival
+	}
+}
+
+// percentileDelay returns the delay that the given percentage of arrivals were within.
+func percentileDelay(delays []time.Duration, percentile float64) time.Duration {
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	rank := int(math.Ceil(percentile / 100 * float64(len(delays))))
+	return delays[min(max(rank, 1), len(delays))-1]
+}
+
+// Run executes the check.
+func (c *GossipLatencyCheck) Run(ctx context.Context, log *logger.CheckLogger, cfg checks.Config) (*checks.Result, error) {
+	log.Print("\n=== Running gossip arrival latency check")
+
+	head, err := c.reference.BlockHeader(ctx, "head")
+	if err != nil && c.reference == c.client {
+		return nodeFailure(c, log, c.node, errors.Wrap(err, "failed to get head")), nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to get reference head")
+	}
+
+	c.mu.Lock()
+	arrivals := c.arrivals
+	c.arrivals = make(map[string]map[string]gossipArrival)
+	slotDuration := c.slotDuration
+	lastHead := c.lastHead
+	c.lastHead = head.Slot
+	c.mu.Unlock()
+
+	// The listener hasn't been able to read the chain timing from the node since the test started.
+	if slotDuration == 0 {
+		return nodeFailure(c, log, c.node, fmt.Errorf("failed to get chain timing")), nil
+	}
+	deadline := c.deadline
+	if deadline == 0 {
+		deadline = slotDuration / 3
+	}
+
+	details := map[string]interface{}{
+		"percentile": c.percentile,
+		"deadline":   deadline.String(),
+	}
+	var late []string
+	if lastHead != 0 && head.Slot > lastHead && len(arrivals[gossipKindBlock]) == 0 {
+		log.Printf("  - No blocks arrived while the head moved from slot %d to %d", lastHead, head.Slot)
+
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusFail,
+			Description:   fmt.Sprintf("No blocks arrived while the head moved from slot %d to %d", lastHead, head.Slot),
+			Timestamp:     time.Now(),
+			Details:       details,
+			AffectedNodes: []string{c.node.Name},
+		}, nil
+	}
+	for _, kind := range []string{gossipKindBlock, gossipKindBlobs, gossipKindColumn} {
+		if len(arrivals[kind]) == 0 {
+			continue
+		}
+
+		var delays []time.Duration
+		for _, arrival := range arrivals[kind] {
+			delays = append(delays, arrival.delay)
+		}
+		delay := percentileDelay(delays, c.percentile)
+		details[kind] = fmt.Sprintf("p%g %s over %d blocks", c.percentile, delay.Round(time.Millisecond), len(delays))
+		log.Printf("  - %s: p%g arrival %s after slot start over %d blocks", kind, c.percentile, delay.Round(time.Millisecond), len(delays))
+
+		if delay > deadline {
+			late = append(late, kind)
+		}
+	}
+
+	if len(late) == 0 {
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   fmt.Sprintf("Gossip arrives within %s at p%g", deadline, c.percentile),
+			Timestamp:     time.Now(),
+			Details:       details,
+			AffectedNodes: []string{},
+		}, nil
+	}
+
+	return &checks.Result{
+		Name:          c.Name(),
+		Category:      c.Category(),
+		Status:        checks.StatusFail,
+		Description:   fmt.Sprintf("p%g arrival of %s is after the %s deadline", c.percentile, strings.Join(late, ", "), deadline),
+		Timestamp:     time.Now(),
+		Details:       details,
+		AffectedNodes: []string{c.node.Name},
+	}, nil
+}
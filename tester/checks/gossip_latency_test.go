@@ -0,0 +1,219 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niran/blob-benchmarks/tester/beacon"
+)
+
+// fakeClock is a Clock whose sleeps only return when the test wakes them.
+type fakeClock struct {
+	sleeps chan time.Duration
+	wake   chan struct{}
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{sleeps: make(chan time.Duration), wake: make(chan struct{})}
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps <- d
+	<-c.wake
+}
+
+// nextSleep waits for the listener to sleep, failing the test if it doesn't.
+func (c *fakeClock) nextSleep(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.sleeps:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't sleep")
+		return 0
+	}
+}
+
+func TestPercentileDelay(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		var delays []time.Duration
+		for _, value := range values {
+			delays = append(delays, time.Duration(value)*time.Millisecond)
+		}
+		return delays
+	}
+
+	tests := []struct {
+		name       string
+		delays     []time.Duration
+		percentile float64
+		want       time.Duration
+	}{
+		{name: "single", delays: ms(700), percentile: 95, want: 700 * time.Millisecond},
+		{name: "unsorted", delays: ms(900, 100, 500), percentile: 50, want: 500 * time.Millisecond},
+		{name: "p95 of 20", delays: ms(20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1), percentile: 95, want: 19 * time.Millisecond},
+		{name: "p95 of 10 rounds up", delays: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), percentile: 95, want: 10 * time.Millisecond},
+		{name: "p100", delays: ms(3, 1, 2), percentile: 100, want: 3 * time.Millisecond},
+		{name: "p0 is the earliest", delays: ms(3, 1, 2), percentile: 0, want: 1 * time.Millisecond},
+		{name: "negative delays", delays: ms(-50, 200, 100), percentile: 50, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentileDelay(tt.delays, tt.percentile); got != tt.want {
+				t.Errorf("percentileDelay() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGossipLatencyRecord(t *testing.T) {
+	genesis := time.Unix(1_700_000_000, 0)
+	event := func(topic string, data string, delay time.Duration) beacon.Event {
+		// Slot 2 starts 24s after genesis.
+		return beacon.Event{Topic: topic, Data: []byte(data), Received: genesis.Add(24*time.Second + delay)}
+	}
+	block := `{"slot": "2", "block": "0xaa"}`
+	sidecar := `{"slot": "2", "block_root": "0xaa", "index": "0"}`
+
+	tests := []struct {
+		name   string
+		events []beacon.Event
+		want   map[string]map[string]gossipArrival
+	}{
+		{
+			name:   "block",
+			events: []beacon.Event{event("block", block, 900*time.Millisecond)},
+			want:   map[string]map[string]gossipArrival{gossipKindBlock: {"0xaa": {slot: 2, delay: 900 * time.Millisecond}}},
+		},
+		{
+			name: "earliest block event",
+			events: []beacon.Event{
+				event("block_gossip", block, 400*time.Millisecond),
+				event("block", block, 1200*time.Millisecond),
+			},
+			want: map[string]map[string]gossipArrival{gossipKindBlock: {"0xaa": {slot: 2, delay: 400 * time.Millisecond}}},
+		},
+		{
+			name: "latest sidecar",
+			events: []beacon.Event{
+				event("blob_sidecar", sidecar, 2*time.Second),
+				event("blob_sidecar", sidecar, 3*time.Second),
+				event("blob_sidecar", sidecar, time.Second),
+				event("data_column_sidecar", sidecar, 5*time.Second),
+			},
+			want: map[string]map[string]gossipArrival{
+				gossipKindBlobs:  {"0xaa": {slot: 2, delay: 3 * time.Second}},
+				gossipKindColumn: {"0xaa": {slot: 2, delay: 5 * time.Second}},
+			},
+		},
+		{
+			name: "separate blocks",
+			events: []beacon.Event{
+				event("block", block, time.Second),
+				event("block", `{"slot": "3", "block": "0xbb"}`, 13*time.Second),
+			},
+			want: map[string]map[string]gossipArrival{gossipKindBlock: {
+				"0xaa": {slot: 2, delay: time.Second},
+				"0xbb": {slot: 3, delay: time.Second},
+			}},
+		},
+		{
+			name: "undecodable events",
+			events: []beacon.Event{
+				event("block", `not json`, time.Second),
+				event("block", `{"slot": "two", "block": "0xaa"}`, time.Second),
+			},
+			want: map[string]map[string]gossipArrival{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &GossipLatencyCheck{
+				genesis:      genesis,
+				slotDuration: 12 * time.Second,
+				arrivals:     make(map[string]map[string]gossipArrival),
+			}
+			for _, event := range tt.events {
+				c.record(event)
+			}
+			if fmt.Sprint(c.arrivals) != fmt.Sprint(tt.want) {
+				t.Errorf("arrivals = %v, want %v", c.arrivals, tt.want)
+			}
+		})
+	}
+}
+
+func TestGossipLatencyListenRetriesOnClock(t *testing.T) {
+	var mu sync.Mutex
+	genesisRequests, blockStreams := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			genesisRequests++
+			if genesisRequests <= 2 {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"data": {"genesis_time": "1700000000"}}`)
+		case "/eth/v1/config/spec":
+			fmt.Fprint(w, `{"data": {"SECONDS_PER_SLOT": "12", "SLOTS_PER_EPOCH": "32"}}`)
+		case "/eth/v1/events":
+			if r.URL.Query().Get("topics") != "block" {
+				http.Error(w, "unsupported topic", http.StatusBadRequest)
+				return
+			}
+			// The first stream ends straight away, and the listener reconnects.
+			blockStreams++
+			if blockStreams > 1 {
+				fmt.Fprint(w, "event: block\ndata: {\"slot\": \"2\", \"block\": \"0xaa\"}\n\n")
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock()
+	c := NewGossipLatencyCheck(ctx, Node{Name: "cl-1", BeaconURL: server.URL}, Node{}, 0, 0, clock)
+
+	// Chain timing is retried until the node answers.
+	for i := 0; i < 2; i++ {
+		if d := clock.nextSleep(t); d != gossipRetryInterval {
+			t.Errorf("sleep %d = %s, want %s", i, d, gossipRetryInterval)
+		}
+		clock.wake <- struct{}{}
+	}
+
+	// The block stream is reconnected after it ends, and its event is recorded.
+	if d := clock.nextSleep(t); d != gossipRetryInterval {
+		t.Errorf("reconnect sleep = %s, want %s", d, gossipRetryInterval)
+	}
+	clock.wake <- struct{}{}
+	clock.nextSleep(t)
+
+	c.mu.Lock()
+	slotDuration, arrivals := c.slotDuration, len(c.arrivals[gossipKindBlock])
+	c.mu.Unlock()
+	if slotDuration != 12*time.Second {
+		t.Errorf("slot duration = %s, want 12s", slotDuration)
+	}
+	if arrivals != 1 {
+		t.Errorf("recorded %d block arrivals, want 1", arrivals)
+	}
+
+	// Cancelling stops the listener without waiting for the clock.
+	cancel()
+	if c.sleep(ctx, gossipRetryInterval) {
+		t.Error("sleep() = true after ctx was cancelled")
+	}
+}
@@ -0,0 +1,132 @@
+package checks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// metricSample is one series of a metric in the Prometheus text format.
+type metricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// metricSamples maps metric names to their series.
+type metricSamples map[string][]metricSample
+
+var metricsClient = &http.Client{Timeout: 10 * time.Second}
+
+// scrapeMetrics fetches and parses a node's Prometheus metrics.
+func scrapeMetrics(ctx context.Context, url string) (metricSamples, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request for %s", url)
+	}
+
+	resp, err := metricsClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get %s: status %d, body: %s", url, resp.StatusCode, string(body))
+	}
+
+	samples, err := parseMetrics(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", url)
+	}
+	return samples, nil
+}
+
+// parseMetrics parses metrics in the Prometheus text format.
+func parseMetrics(r io.Reader) (metricSamples, error) {
+	samples := make(metricSamples)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, sample, ok := parseMetricLine(scanner.Text())
+		if ok {
+			samples[name] = append(samples[name], sample)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// parseMetricLine parses a line such as `name{label="value"} 1.5 1700000000000`, skipping comments
+// and anything it can't parse.
+func parseMetricLine(line string) (string, metricSample, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", metricSample{}, false
+	}
+
+	sample := metricSample{labels: make(map[string]string)}
+	var name, rest string
+	if open := strings.IndexByte(line, '{'); open >= 0 {
+		end := strings.LastIndexByte(line, '}')
+		if end < open {
+			return "", metricSample{}, false
+		}
+		name, rest = line[:open], line[end+1:]
+		for _, pair := range splitLabels(line[open+1 : end]) {
+			key, value, ok := strings.Cut(pair, "=")
+			if ok {
+				sample.labels[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	} else {
+		var ok bool
+		name, rest, ok = strings.Cut(line, " ")
+		if !ok {
+			return "", metricSample{}, false
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", metricSample{}, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", metricSample{}, false
+	}
+	sample.value = value
+	return name, sample, true
+}
+
+// splitLabels splits a label list on the commas that aren't inside quoted values.
+func splitLabels(s string) []string {
+	var pairs []string
+	inQuotes, escaped, start := false, false, 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ',' && !inQuotes:
+			pairs = append(pairs, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		pairs = append(pairs, s[start:])
+	}
+	return pairs
+}
@@ -0,0 +1,232 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/clients"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+const (
+	// proposalLookbackSlots limits how far back a run looks if it's long after the last one.
+	proposalLookbackSlots = 64
+	// proposalSettleSlots are left unchecked at the head, where blocks may still be reorged.
+	proposalSettleSlots = 2
+)
+
+// MissedProposalsCheck is a check that walks the slots since it last ran on a healthy reference node
+// and reports the slots where the node under test's validators were due to propose but the block is
+// missing from the canonical chain, either because it was never seen or because it was orphaned.
+type MissedProposalsCheck struct {
+	node       Node
+	client     *beacon.Client
+	reference  *beacon.Client
+	validators map[uint64]bool
+	// nextSlot is the first slot the next run checks, or zero until the check has found the head.
+	nextSlot uint64
+}
+
+// NewMissedProposalsCheck creates a new MissedProposalsCheck for the node's validators, judged by the
+// reference node's view of the chain. Only slots after the reference's current head are checked, so
+// it must be created before the node's network is degraded. If the head can't be found now, the
+// first run finds it instead.
+func NewMissedProposalsCheck(node Node, reference Node, validators []uint64) *MissedProposalsCheck {
+	set := make(map[uint64]bool, len(validators))
+	for _, index := range validators {
+		set[index] = true
+	}
+
+	c := &MissedProposalsCheck{
+		node:       node,
+		client:     beacon.NewClient(node.BeaconURL),
+		reference:  beacon.NewClient(reference.BeaconURL),
+		validators: set,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), baselineTimeout)
+	defer cancel()
+	head, err := c.reference.BlockHeader(ctx, "head")
+	if err != nil {
+		gethlog.Warn("Failed to find the reference head to check proposals from", "node", node.Name, "error", err)
+	} else {
+		c.nextSlot = head.Slot + 1
+		gethlog.Info("Checking proposals from the reference head", "node", node.Name, "slot", c.nextSlot)
+	}
+	return c
+}
+
+// Name returns the name of the check.
+func (c *MissedProposalsCheck) Name() string {
+	return "Missed or orphaned proposals"
+}
+
+// Category returns the category of the check.
+func (c *MissedProposalsCheck) Category() checks.Category {
+	return checks.CategoryGeneral
+}
+
+// ClientType returns the client type of the check.
+func (c *MissedProposalsCheck) ClientType() clients.ClientType {
+	return clients.ClientTypeCL
+}
+
+// proposalOutcome classifies the node's proposal at a slot and returns the canonical block's blob
+// count if it was proposed.
+func (c *MissedProposalsCheck) proposalOutcome(ctx context.Context, slot uint64, proposer uint64) (string, int, error) {
+	headers, err := c.reference.BlockHeaders(ctx, slot)
+	if err != nil && !errors.Is(err, beacon.ErrNotFound) {
+		return "", 0, errors.Wrapf(err, "failed to get reference headers at slot %d", slot)
+	}
+
+	orphaned := false
+	for _, header := range headers {
+		if header.ProposerIndex != proposer {
+			continue
+		}
+		if header.Canonical {
+			blobCount, err := c.reference.BlobCount(ctx, header.Root)
+			if err != nil {
+				return "", 0, errors.Wrapf(err, "failed to get block at slot %d", slot)
+			}
+			return "proposed", blobCount, nil
+		}
+		orphaned = true
+	}
+
+	// The reference may never have seen a block that the node produced but failed to publish in
+	// time, so ask the node too. A throttled node may not answer, in which case the slot counts as
+	// missed.
+	if !orphaned {
+		headers, err := c.client.BlockHeaders(ctx, slot)
+		if err != nil && !errors.Is(err, beacon.ErrNotFound) {
+			gethlog.Debug("Node didn't answer for its proposal, counting it as missed", "node", c.node.Name, "slot", slot, "error", err)
+		}
+		for _, header := range headers {
+			if header.ProposerIndex == proposer {
+				orphaned = true
+			}
+		}
+	}
+
+	if orphaned {
+		return "orphaned", 0, nil
+	}
+	return "missed", 0, nil
+}
+
+// Run executes the check.
+func (c *MissedProposalsCheck) Run(ctx context.Context, log *logger.CheckLogger, cfg checks.Config) (*checks.Result, error) {
+	log.Print("\n=== Running missed proposals check")
+
+	spec, err := c.reference.Spec(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get spec")
+	}
+	head, err := c.reference.BlockHeader(ctx, "head")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get reference head")
+	}
+	if c.nextSlot == 0 {
+		c.nextSlot = head.Slot + 1
+		log.Printf("  - Checking proposals after slot %d", head.Slot)
+
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   "Found the slot to check proposals from",
+			Timestamp:     time.Now(),
+			Details:       map[string]interface{}{"nextSlot": c.nextSlot},
+			AffectedNodes: []string{},
+		}, nil
+	}
+	if head.Slot < proposalSettleSlots {
+		return nil, fmt.Errorf("chain is too new to check proposals")
+	}
+
+	lastSlot := head.Slot - proposalSettleSlots
+	firstSlot := c.nextSlot
+	if lastSlot >= proposalLookbackSlots && firstSlot < lastSlot-proposalLookbackSlots+1 {
+		firstSlot = lastSlot - proposalLookbackSlots + 1
+	}
+
+	duties := make(map[uint64]uint64)
+	for epoch := firstSlot / spec.SlotsPerEpoch; epoch <= lastSlot/spec.SlotsPerEpoch; epoch++ {
+		epochDuties, err := c.reference.ProposerDuties(ctx, epoch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get proposer duties for epoch %d", epoch)
+		}
+		for _, duty := range epochDuties {
+			duties[duty.Slot] = duty.ValidatorIndex
+		}
+	}
+
+	var outcomes, failures []string
+	var proposed, blobs int
+	for slot := firstSlot; slot <= lastSlot; slot++ {
+		proposer, ok := duties[slot]
+		if !ok || !c.validators[proposer] {
+			continue
+		}
+
+		outcome, blobCount, err := c.proposalOutcome(ctx, slot, proposer)
+		if err != nil {
+			return nil, err
+		}
+
+		description := fmt.Sprintf("slot %d (validator %d): %s", slot, proposer, outcome)
+		if outcome == "proposed" {
+			proposed++
+			blobs += blobCount
+			description += fmt.Sprintf(" with %d blobs", blobCount)
+		} else {
+			failures = append(failures, description)
+		}
+		outcomes = append(outcomes, description)
+		log.Printf("  - %s", description)
+	}
+	// Until the head has settled past the slot the check started from, there is nothing to check.
+	if lastSlot+1 > c.nextSlot {
+		c.nextSlot = lastSlot + 1
+	}
+
+	details := map[string]interface{}{
+		"firstSlot": firstSlot,
+		"lastSlot":  lastSlot,
+		"duties":    len(outcomes),
+		"proposed":  proposed,
+		"blobs":     blobs,
+		"outcomes":  strings.Join(outcomes, "\n"),
+	}
+
+	if len(failures) == 0 {
+		log.Printf("  - All %d proposals from slot %d to %d are canonical", proposed, firstSlot, lastSlot)
+
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   fmt.Sprintf("All %d proposals are canonical", proposed),
+			Timestamp:     time.Now(),
+			Details:       details,
+			AffectedNodes: []string{},
+		}, nil
+	}
+
+	return &checks.Result{
+		Name:          c.Name(),
+		Category:      c.Category(),
+		Status:        checks.StatusFail,
+		Description:   fmt.Sprintf("%d of %d proposals are missing from the canonical chain", len(failures), len(outcomes)),
+		Timestamp:     time.Now(),
+		Details:       details,
+		AffectedNodes: []string{c.node.Name},
+	}, nil
+}
@@ -0,0 +1,159 @@
+package checks
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+)
+
+func TestProposalOutcome(t *testing.T) {
+	const slot, proposer = 10, 7
+
+	tests := []struct {
+		name      string
+		reference []fakeBlock
+		node      []fakeBlock
+		nodeFails bool
+		want      string
+		wantBlobs int
+	}{
+		{
+			name:      "proposed",
+			reference: []fakeBlock{{slot: slot, root: "0xaa", proposer: proposer, canonical: true, blobs: 3}},
+			want:      "proposed",
+			wantBlobs: 3,
+		},
+		{
+			name: "orphaned on the reference",
+			reference: []fakeBlock{
+				{slot: slot, root: "0xaa", proposer: 8, canonical: true},
+				{slot: slot, root: "0xbb", proposer: proposer},
+			},
+			want: "orphaned",
+		},
+		{
+			name: "only seen by the node",
+			node: []fakeBlock{{slot: slot, root: "0xcc", proposer: proposer, canonical: true}},
+			want: "orphaned",
+		},
+		{
+			name:      "another proposer's block",
+			reference: []fakeBlock{{slot: slot, root: "0xaa", proposer: 8, canonical: true}},
+			node:      []fakeBlock{{slot: slot, root: "0xaa", proposer: 8, canonical: true}},
+			want:      "missed",
+		},
+		{
+			name: "empty slot",
+			want: "missed",
+		},
+		{
+			name:      "node doesn't answer",
+			nodeFails: true,
+			want:      "missed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reference := newFakeBeacon(tt.reference...).start()
+			defer reference.Close()
+			fakeNode := newFakeBeacon(tt.node...)
+			if tt.nodeFails {
+				fakeNode.fail["/eth/v1/beacon/headers"] = http.StatusServiceUnavailable
+			}
+			node := fakeNode.start()
+			defer node.Close()
+
+			c := NewMissedProposalsCheck(Node{Name: "cl-1", BeaconURL: node.URL}, Node{BeaconURL: reference.URL}, []uint64{proposer})
+			outcome, blobs, err := c.proposalOutcome(context.Background(), slot, proposer)
+			if err != nil {
+				t.Fatalf("proposalOutcome() error = %v", err)
+			}
+			if outcome != tt.want || blobs != tt.wantBlobs {
+				t.Errorf("proposalOutcome() = %s with %d blobs, want %s with %d", outcome, blobs, tt.want, tt.wantBlobs)
+			}
+		})
+	}
+}
+
+func TestProposalOutcomeReferenceFailure(t *testing.T) {
+	fakeReference := newFakeBeacon()
+	fakeReference.fail["/eth/v1/beacon/headers"] = http.StatusInternalServerError
+	reference := fakeReference.start()
+	defer reference.Close()
+
+	c := NewMissedProposalsCheck(Node{Name: "cl-1", BeaconURL: reference.URL}, Node{BeaconURL: reference.URL}, []uint64{7})
+	if _, _, err := c.proposalOutcome(context.Background(), 10, 7); err == nil {
+		t.Error("proposalOutcome() error = nil when the reference failed")
+	}
+}
+
+func TestMissedProposalsChecksFromCreation(t *testing.T) {
+	fakeReference := newFakeBeacon(
+		fakeBlock{slot: 98, root: "0x98", proposer: 1, canonical: true},
+		fakeBlock{slot: 100, root: "0x100", proposer: 1, canonical: true},
+	)
+	// The node's validator missed slot 99 before the check was created.
+	fakeReference.duties = map[uint64]uint64{99: 7, 101: 7, 102: 7}
+	reference := fakeReference.start()
+	defer reference.Close()
+	node := newFakeBeacon().start()
+	defer node.Close()
+
+	c := NewMissedProposalsCheck(Node{Name: "cl-1", BeaconURL: node.URL}, Node{BeaconURL: reference.URL}, []uint64{7})
+	if c.nextSlot != 101 {
+		t.Fatalf("nextSlot = %d, want 101", c.nextSlot)
+	}
+
+	// Nothing has settled since the check was created.
+	fakeReference.mu.Lock()
+	fakeReference.blocks = append(fakeReference.blocks, fakeBlock{slot: 101, root: "0x101", proposer: 7, canonical: true, blobs: 2})
+	fakeReference.mu.Unlock()
+	result, err := c.Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Status != checks.StatusOK || result.Details["duties"] != 0 || c.nextSlot != 101 {
+		t.Errorf("Run() before any slot settled = %s with %v duties, next slot %d", result.Status, result.Details["duties"], c.nextSlot)
+	}
+
+	// Slot 102 is missed, and only slots 101 and 102 are checked.
+	fakeReference.mu.Lock()
+	fakeReference.blocks = append(fakeReference.blocks, fakeBlock{slot: 104, root: "0x104", proposer: 1, canonical: true})
+	fakeReference.mu.Unlock()
+	result, err = c.Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Status != checks.StatusFail || result.Details["firstSlot"] != uint64(101) || result.Details["duties"] != 2 || result.Details["proposed"] != 1 {
+		t.Errorf("Run() = %s: %s, details %v", result.Status, result.Description, result.Details)
+	}
+	if c.nextSlot != 103 {
+		t.Errorf("nextSlot = %d, want 103", c.nextSlot)
+	}
+}
+
+func TestMissedProposalsFindsHeadOnFirstRun(t *testing.T) {
+	fakeReference := newFakeBeacon(fakeBlock{slot: 100, root: "0x100", proposer: 1, canonical: true})
+	fakeReference.fail["/eth/v1/beacon/headers/head"] = http.StatusServiceUnavailable
+	reference := fakeReference.start()
+	defer reference.Close()
+
+	c := NewMissedProposalsCheck(Node{Name: "cl-1", BeaconURL: reference.URL}, Node{BeaconURL: reference.URL}, []uint64{7})
+	if c.nextSlot != 0 {
+		t.Fatalf("nextSlot = %d without a head, want 0", c.nextSlot)
+	}
+
+	fakeReference.mu.Lock()
+	delete(fakeReference.fail, "/eth/v1/beacon/headers/head")
+	fakeReference.mu.Unlock()
+	result, err := c.Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Status != checks.StatusOK || c.nextSlot != 101 {
+		t.Errorf("first Run() = %s, next slot %d, want OK and 101", result.Status, c.nextSlot)
+	}
+}
@@ -0,0 +1,313 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gethlog "github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/clients"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/niran/blob-benchmarks/tester/beacon"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMinPeerRatio is the fraction of the baseline connected peers that must remain.
+	DefaultMinPeerRatio = 0.5
+	// DefaultMinMeshRatio is the fraction of each topic's baseline mesh peers that must remain.
+	DefaultMinMeshRatio = 0.5
+	// DefaultMaxScoreDrop is how far the average peer score may fall below the baseline.
+	DefaultMaxScoreDrop = 20
+
+	baselineTimeout = 30 * time.Second
+)
+
+// meshPeerMetrics are the names clients export the number of mesh peers per topic under. The first
+// one the node exports is used.
+var meshPeerMetrics = []string{
+	"gossipsub_mesh_peer_counts",
+	"libp2p_gossipsub_mesh_peer_counts",
+	"gossipsub_mesh_peers",
+	"p2p_mesh_peers",
+}
+
+// peerScoreMetrics are the names clients export the gossipsub scores they give their peers under,
+// either as a histogram or as a gauge per peer. The first one the node exports is used.
+var peerScoreMetrics = []string{
+	"gossipsub_score_per_mesh",
+	"libp2p_gossipsub_score_per_mesh",
+	"gossipsub_peer_score",
+	"p2p_peer_score",
+}
+
+// topicLabels are the labels clients put a series' gossip topic in.
+var topicLabels = []string{"topic", "topic_hash", "hash"}
+
+// PeerThresholds sets how far the peers of a node may degrade from their baseline. Zero values use
+// the defaults.
+type PeerThresholds struct {
+	MinPeerRatio float64
+	MinMeshRatio float64
+	MaxScoreDrop float64
+}
+
+// peerSnapshot is the state of a node's peers at one time. mesh is nil and hasScore is false if the
+// node doesn't export them.
+type peerSnapshot struct {
+	connected uint64
+	mesh      map[string]float64
+	score     float64
+	hasScore  bool
+}
+
+// PeerHealthCheck is a check that verifies that a node keeps enough of the connected peers, mesh
+// peers and peer scores it had before the test started degrading its network. Nodes are often
+// descored and disconnected before anything else visibly fails.
+//
+// Every run is compared with the baseline. After a failing run, how far the peers have come back
+// since is reported in the details, but doesn't change the verdict.
+type PeerHealthCheck struct {
+	node       Node
+	client     *beacon.Client
+	thresholds PeerThresholds
+
+	mu       sync.Mutex
+	baseline *peerSnapshot
+	// lastFailure is the snapshot from the last run if it failed, and otherwise nil.
+	lastFailure *peerSnapshot
+}
+
+// NewPeerHealthCheck creates a new PeerHealthCheck and records the node's baseline, so it must be
+// created before the node's network is degraded. If the baseline can't be recorded now, the first
+// run records it instead.
+func NewPeerHealthCheck(node Node, thresholds PeerThresholds) *PeerHealthCheck {
+	if thresholds.MinPeerRatio == 0 {
+		thresholds.MinPeerRatio = DefaultMinPeerRatio
+	}
+	if thresholds.MinMeshRatio == 0 {
+		thresholds.MinMeshRatio = DefaultMinMeshRatio
+	}
+	if thresholds.MaxScoreDrop == 0 {
+		thresholds.MaxScoreDrop = DefaultMaxScoreDrop
+	}
+
+	c := &PeerHealthCheck{
+		node:       node,
+		client:     beacon.NewClient(node.BeaconURL),
+		thresholds: thresholds,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), baselineTimeout)
+	defer cancel()
+	baseline, err := c.snapshot(ctx)
+	if err != nil {
+		gethlog.Warn("Failed to record peer baseline", "node", node.Name, "error", err)
+	} else {
+		c.baseline = baseline
+		gethlog.Info("Recorded peer baseline", "node", node.Name, "connected", baseline.connected, "mesh_topics", len(baseline.mesh), "score", baseline.score)
+	}
+	return c
+}
+
+// Name returns the name of the check.
+func (c *PeerHealthCheck) Name() string {
+	return "Peer degradation"
+}
+
+// Category returns the category of the check.
+func (c *PeerHealthCheck) Category() checks.Category {
+	return checks.CategoryGeneral
+}
+
+// ClientType returns the client type of the check.
+func (c *PeerHealthCheck) ClientType() clients.ClientType {
+	return clients.ClientTypeCL
+}
+
+// snapshot reads the node's connected peers from its beacon API, and its mesh peers and peer scores
+// from its metrics if it exports them.
+func (c *PeerHealthCheck) snapshot(ctx context.Context) (*peerSnapshot, error) {
+	connected, err := c.client.PeerCount(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get peer count")
+	}
+	snapshot := &peerSnapshot{connected: connected}
+	if c.node.MetricsURL == "" {
+		return snapshot, nil
+	}
+
+	samples, err := scrapeMetrics(ctx, c.node.MetricsURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get metrics")
+	}
+	snapshot.addMetrics(samples)
+	return snapshot, nil
+}
+
+// addMetrics reads the mesh peers per topic and the average peer score from the node's metrics,
+// leaving them unset if it doesn't export them.
+func (snapshot *peerSnapshot) addMetrics(samples metricSamples) {
+	for _, name := range meshPeerMetrics {
+		if _, ok := samples[name]; !ok {
+			continue
+		}
+		snapshot.mesh = make(map[string]float64)
+		for _, sample := range samples[name] {
+			snapshot.mesh[sampleTopic(sample)] += sample.value
+		}
+		break
+	}
+
+	for _, name := range peerScoreMetrics {
+		if counts, ok := samples[name+"_count"]; ok {
+			var sum, count float64
+			for _, sample := range samples[name+"_sum"] {
+				sum += sample.value
+			}
+			for _, sample := range counts {
+				count += sample.value
+			}
+			if count > 0 {
+				snapshot.score, snapshot.hasScore = sum/count, true
+			}
+			break
+		}
+		if gauges, ok := samples[name]; ok && len(gauges) > 0 {
+			var sum float64
+			for _, sample := range gauges {
+				sum += sample.value
+			}
+			snapshot.score, snapshot.hasScore = sum/float64(len(gauges)), true
+			break
+		}
+	}
+}
+
+func sampleTopic(sample metricSample) string {
+	for _, label := range topicLabels {
+		if topic := sample.labels[label]; topic != "" {
+			return topic
+		}
+	}
+	return "all"
+}
+
+// Run executes the check.
+func (c *PeerHealthCheck) Run(ctx context.Context, log *logger.CheckLogger, cfg checks.Config) (*checks.Result, error) {
+	log.Print("\n=== Running peer degradation check")
+
+	current, err := c.snapshot(ctx)
+	if err != nil {
+		return nodeFailure(c, log, c.node, err), nil
+	}
+
+	c.mu.Lock()
+	baseline, lastFailure := c.baseline, c.lastFailure
+	if baseline == nil {
+		c.baseline = current
+	}
+	c.mu.Unlock()
+
+	if baseline == nil {
+		log.Printf("  - Recorded baseline of %d connected peers", current.connected)
+
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   "Recorded the peer baseline",
+			Timestamp:     time.Now(),
+			Details:       map[string]interface{}{"connected": current.connected},
+			AffectedNodes: []string{},
+		}, nil
+	}
+
+	result := c.compare(log, current, baseline, lastFailure)
+
+	c.mu.Lock()
+	c.lastFailure = nil
+	if result.Status == checks.StatusFail {
+		c.lastFailure = current
+	}
+	c.mu.Unlock()
+
+	return result, nil
+}
+
+// compare judges the current peers against the baseline, noting how they've changed since the last
+// run if it failed.
+func (c *PeerHealthCheck) compare(log *logger.CheckLogger, current *peerSnapshot, baseline *peerSnapshot, lastFailure *peerSnapshot) *checks.Result {
+	details := map[string]interface{}{
+		"connected": fmt.Sprintf("%d (baseline %d)", current.connected, baseline.connected),
+	}
+	log.Printf("  - %d connected peers, baseline %d", current.connected, baseline.connected)
+	if lastFailure != nil {
+		details["recovery"] = fmt.Sprintf("%d connected peers at the end of the last failing run", lastFailure.connected)
+		log.Printf("  - %d connected peers at the end of the last failing run", lastFailure.connected)
+	}
+
+	var problems []string
+	if float64(current.connected) < c.thresholds.MinPeerRatio*float64(baseline.connected) {
+		problems = append(problems, fmt.Sprintf("connected peers fell from %d to %d", baseline.connected, current.connected))
+	}
+
+	topics := make([]string, 0, len(baseline.mesh))
+	for topic := range baseline.mesh {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	var meshDetails []string
+	for _, topic := range topics {
+		base, now := baseline.mesh[topic], current.mesh[topic]
+		if base == 0 {
+			continue
+		}
+		meshDetails = append(meshDetails, fmt.Sprintf("%s: %g (baseline %g)", topic, now, base))
+		if now < c.thresholds.MinMeshRatio*base {
+			problems = append(problems, fmt.Sprintf("mesh peers on %s fell from %g to %g", topic, base, now))
+		}
+	}
+	if len(meshDetails) > 0 {
+		details["mesh"] = strings.Join(meshDetails, "\n")
+	}
+
+	if baseline.hasScore && current.hasScore {
+		details["score"] = fmt.Sprintf("%.2f (baseline %.2f)", current.score, baseline.score)
+		log.Printf("  - Average peer score %.2f, baseline %.2f", current.score, baseline.score)
+		if baseline.score-current.score > c.thresholds.MaxScoreDrop {
+			problems = append(problems, fmt.Sprintf("average peer score fell from %.2f to %.2f", baseline.score, current.score))
+		}
+	}
+
+	if len(problems) == 0 {
+		return &checks.Result{
+			Name:          c.Name(),
+			Category:      c.Category(),
+			Status:        checks.StatusOK,
+			Description:   "Peers are within their thresholds of the baseline",
+			Timestamp:     time.Now(),
+			Details:       details,
+			AffectedNodes: []string{},
+		}
+	}
+
+	for _, problem := range problems {
+		log.Printf("  - %s", problem)
+	}
+	details["problems"] = strings.Join(problems, "\n")
+
+	return &checks.Result{
+		Name:          c.Name(),
+		Category:      c.Category(),
+		Status:        checks.StatusFail,
+		Description:   fmt.Sprintf("Peers degraded: %s", strings.Join(problems, "; ")),
+		Timestamp:     time.Now(),
+		Details:       details,
+		AffectedNodes: []string{c.node.Name},
+	}
+}
@@ -0,0 +1,167 @@
+package checks
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+)
+
+const blockTopic = "/eth2/bba4da96/beacon_block/ssz_snappy"
+
+const prysmMetrics = `# HELP p2p_peer_count Current number of peers in each state
+# TYPE p2p_peer_count gauge
+p2p_peer_count{state="Connected"} 52
+p2p_peer_count{state="Disconnected"} 3
+# HELP gossipsub_mesh_peers The number of peers in the mesh of each topic
+# TYPE gossipsub_mesh_peers gauge
+gossipsub_mesh_peers{topic="/eth2/bba4da96/beacon_block/ssz_snappy"} 8
+gossipsub_mesh_peers{topic="/eth2/bba4da96/blob_sidecar_0/ssz_snappy"} 6
+gossipsub_mesh_peers{topic="/eth2/bba4da96/blob_sidecar_1/ssz_snappy"} 5
+`
+
+const lighthouseMetrics = `# HELP gossipsub_mesh_peer_counts Number of peers in each topic in our mesh.
+# TYPE gossipsub_mesh_peer_counts gauge
+gossipsub_mesh_peer_counts{hash="/eth2/bba4da96/beacon_block/ssz_snappy"} 7
+gossipsub_mesh_peer_counts{hash="/eth2/bba4da96/beacon_aggregate_and_proof/ssz_snappy"} 9
+# HELP gossipsub_score_per_mesh Histogram of scores per mesh topic.
+# TYPE gossipsub_score_per_mesh histogram
+gossipsub_score_per_mesh_sum{hash="/eth2/bba4da96/beacon_block/ssz_snappy"} 210.5
+gossipsub_score_per_mesh_count{hash="/eth2/bba4da96/beacon_block/ssz_snappy"} 7
+gossipsub_score_per_mesh_bucket{le="+Inf",hash="/eth2/bba4da96/beacon_block/ssz_snappy"} 7
+gossipsub_score_per_mesh_sum{hash="/eth2/bba4da96/beacon_aggregate_and_proof/ssz_snappy"} 89.5
+gossipsub_score_per_mesh_count{hash="/eth2/bba4da96/beacon_aggregate_and_proof/ssz_snappy"} 9
+`
+
+func TestParseMetricLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantName   string
+		wantLabels map[string]string
+		wantValue  float64
+		wantOK     bool
+	}{
+		{line: "# TYPE p2p_peer_count gauge"},
+		{line: ""},
+		{line: "beacon_head_slot 1234", wantName: "beacon_head_slot", wantLabels: map[string]string{}, wantValue: 1234, wantOK: true},
+		{line: `p2p_peer_count{state="Connected"} 52 1700000000000`, wantName: "p2p_peer_count", wantLabels: map[string]string{"state": "Connected"}, wantValue: 52, wantOK: true},
+		{line: `gossipsub_score_per_mesh_bucket{le="+Inf",hash="a,b"} 7`, wantName: "gossipsub_score_per_mesh_bucket", wantLabels: map[string]string{"le": "+Inf", "hash": "a,b"}, wantValue: 7, wantOK: true},
+		{line: `broken{state="Connected" 52`},
+		{line: "not_a_number NaNish"},
+	}
+	for _, tt := range tests {
+		name, sample, ok := parseMetricLine(tt.line)
+		if ok != tt.wantOK || name != tt.wantName {
+			t.Errorf("parseMetricLine(%q) = %q, %v, want %q, %v", tt.line, name, ok, tt.wantName, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if sample.value != tt.wantValue {
+			t.Errorf("parseMetricLine(%q) value = %g, want %g", tt.line, sample.value, tt.wantValue)
+		}
+		if len(sample.labels) != len(tt.wantLabels) {
+			t.Errorf("parseMetricLine(%q) labels = %v, want %v", tt.line, sample.labels, tt.wantLabels)
+		}
+		for key, value := range tt.wantLabels {
+			if sample.labels[key] != value {
+				t.Errorf("parseMetricLine(%q) label %s = %q, want %q", tt.line, key, sample.labels[key], value)
+			}
+		}
+	}
+}
+
+func TestPeerSnapshotMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		metrics      string
+		wantMesh     map[string]float64
+		wantHasScore bool
+		wantScore    float64
+	}{
+		{
+			name:    "prysm",
+			metrics: prysmMetrics,
+			wantMesh: map[string]float64{
+				blockTopic: 8,
+				"/eth2/bba4da96/blob_sidecar_0/ssz_snappy": 6,
+				"/eth2/bba4da96/blob_sidecar_1/ssz_snappy": 5,
+			},
+		},
+		{
+			name:    "lighthouse",
+			metrics: lighthouseMetrics,
+			wantMesh: map[string]float64{
+				blockTopic: 7,
+				"/eth2/bba4da96/beacon_aggregate_and_proof/ssz_snappy": 9,
+			},
+			wantHasScore: true,
+			wantScore:    300.0 / 16,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := parseMetrics(strings.NewReader(tt.metrics))
+			if err != nil {
+				t.Fatalf("parseMetrics() error = %v", err)
+			}
+
+			var snapshot peerSnapshot
+			snapshot.addMetrics(samples)
+
+			if len(snapshot.mesh) != len(tt.wantMesh) {
+				t.Errorf("mesh = %v, want %v", snapshot.mesh, tt.wantMesh)
+			}
+			for topic, want := range tt.wantMesh {
+				if snapshot.mesh[topic] != want {
+					t.Errorf("mesh[%s] = %g, want %g", topic, snapshot.mesh[topic], want)
+				}
+			}
+			if snapshot.hasScore != tt.wantHasScore || math.Abs(snapshot.score-tt.wantScore) > 1e-9 {
+				t.Errorf("score = %g, %v, want %g, %v", snapshot.score, snapshot.hasScore, tt.wantScore, tt.wantHasScore)
+			}
+		})
+	}
+}
+
+func TestPeerSnapshotWithoutMetrics(t *testing.T) {
+	var snapshot peerSnapshot
+	snapshot.addMetrics(metricSamples{})
+	if snapshot.mesh != nil || snapshot.hasScore {
+		t.Errorf("snapshot = %+v, want no mesh or score", snapshot)
+	}
+}
+
+func TestPeerHealthComparesWithBaseline(t *testing.T) {
+	c := &PeerHealthCheck{
+		node:       Node{Name: "cl-1"},
+		thresholds: PeerThresholds{MinPeerRatio: DefaultMinPeerRatio, MinMeshRatio: DefaultMinMeshRatio, MaxScoreDrop: DefaultMaxScoreDrop},
+	}
+	baseline := &peerSnapshot{connected: 50}
+
+	tests := []struct {
+		name        string
+		current     uint64
+		lastFailure *peerSnapshot
+		wantStatus  checks.Status
+	}{
+		{name: "within threshold", current: 30, wantStatus: checks.StatusOK},
+		{name: "degraded", current: 20, wantStatus: checks.StatusFail},
+		{name: "recovering but still degraded", current: 20, lastFailure: &peerSnapshot{connected: 10}, wantStatus: checks.StatusFail},
+		{name: "recovered", current: 30, lastFailure: &peerSnapshot{connected: 10}, wantStatus: checks.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := c.compare(logger.NewCheckLogger("test"), &peerSnapshot{connected: tt.current}, baseline, tt.lastFailure)
+			if result.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s: %s", result.Status, tt.wantStatus, result.Description)
+			}
+			if _, ok := result.Details["recovery"]; ok != (tt.lastFailure != nil) {
+				t.Errorf("recovery detail = %v, want it only after a failing run", result.Details["recovery"])
+			}
+		})
+	}
+}
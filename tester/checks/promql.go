@@ -0,0 +1,243 @@
+package checks
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/clients"
+	"github.com/ethpandaops/panda-pulse/pkg/grafana"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPromQLChecks are the checks that are always registered unless a checks file replaces them.
+//
+//go:embed promql_checks.yaml
+var defaultPromQLChecks []byte
+
+// PromQLCheckConfig declares a check that fails when a PromQL query returns any series.
+type PromQLCheckConfig struct {
+	Name string `yaml:"name"`
+	// Query is a text/template for the query, given the runner's checks.Config fields (e.g.
+	// {{.ConsensusNode}}) and {{.Threshold}}. It should only return the series that are failing.
+	Query     string  `yaml:"query"`
+	Threshold float64 `yaml:"threshold"`
+	// Labels are the label keys reported for each failing series. Series missing any of them are
+	// ignored, and the first names the affected node.
+	Labels          []string `yaml:"labels"`
+	Category        string   `yaml:"category"`
+	ClientType      string   `yaml:"client_type"`
+	OKDescription   string   `yaml:"ok_description"`
+	FailDescription string   `yaml:"fail_description"`
+}
+
+// Validate checks that the config is complete and fills in the default category, client type and
+// descriptions.
+func (c *PromQLCheckConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("check has no name")
+	}
+	if c.Query == "" {
+		return fmt.Errorf("check %q has no query", c.Name)
+	}
+	if _, err := template.New(c.Name).Parse(c.Query); err != nil {
+		return errors.Wrapf(err, "invalid query for check %q", c.Name)
+	}
+	if len(c.Labels) == 0 {
+		return fmt.Errorf("check %q has no labels", c.Name)
+	}
+
+	switch checks.Category(c.Category) {
+	case "":
+		c.Category = string(checks.CategoryGeneral)
+	case checks.CategoryGeneral, checks.CategorySync:
+	default:
+		return fmt.Errorf("check %q has unknown category %q", c.Name, c.Category)
+	}
+
+	switch clients.ClientType(c.ClientType) {
+	case "":
+		c.ClientType = string(clients.ClientTypeCL)
+	case clients.ClientTypeCL, clients.ClientTypeEL, clients.ClientTypeAll:
+	default:
+		return fmt.Errorf("check %q has unknown client type %q", c.Name, c.ClientType)
+	}
+
+	if c.OKDescription == "" {
+		c.OKDescription = fmt.Sprintf("%s: none", c.Name)
+	}
+	if c.FailDescription == "" {
+		c.FailDescription = c.Name
+	}
+	return nil
+}
+
+// parsePromQLChecks parses and validates a YAML list of checks under a `checks` key.
+func parsePromQLChecks(data []byte) ([]PromQLCheckConfig, error) {
+	var file struct {
+		Checks []PromQLCheckConfig `yaml:"checks"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse checks")
+	}
+
+	for i := range file.Checks {
+		if err := file.Checks[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Checks, nil
+}
+
+// LoadPromQLChecks returns the default PromQL checks, with those in the file at path added. A check
+// in the file with the same name as a default replaces it. If path is empty, only the defaults are
+// returned.
+func LoadPromQLChecks(path string) ([]PromQLCheckConfig, error) {
+	configs, err := parsePromQLChecks(defaultPromQLChecks)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid default checks")
+	}
+	if path == "" {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+	fileConfigs, err := parsePromQLChecks(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid checks in %s", path)
+	}
+
+	for _, fileConfig := range fileConfigs {
+		replaced := false
+		for i := range configs {
+			if configs[i].Name == fileConfig.Name {
+				configs[i] = fileConfig
+				replaced = true
+			}
+		}
+		if !replaced {
+			configs = append(configs, fileConfig)
+		}
+	}
+	return configs, nil
+}
+
+// PromQLCheck is a check declared by a PromQLCheckConfig.
+type PromQLCheck struct {
+	grafanaClient grafana.Client
+	config        PromQLCheckConfig
+	query         *template.Template
+}
+
+// NewPromQLCheck creates a new PromQLCheck from a validated config.
+func NewPromQLCheck(grafanaClient grafana.Client, config PromQLCheckConfig) *PromQLCheck {
+	return &PromQLCheck{
+		grafanaClient: grafanaClient,
+		config:        config,
+		query:         template.Must(template.New(config.Name).Parse(config.Query)),
+	}
+}
+
+// Name returns the name of the check.
+func (c *PromQLCheck) Name() string {
+	return c.config.Name
+}
+
+// Category returns the category of the check.
+func (c *PromQLCheck) Category() checks.Category {
+	return checks.Category(c.config.Category)
+}
+
+// ClientType returns the client type of the check.
+func (c *PromQLCheck) ClientType() clients.ClientType {
+	return clients.ClientType(c.config.ClientType)
+}
+
+// Run executes the check.
+func (c *PromQLCheck) Run(ctx context.Context, log *logger.CheckLogger, cfg checks.Config) (*checks.Result, error) {
+	var buf bytes.Buffer
+	err := c.query.Execute(&buf, struct {
+		checks.Config
+		Threshold float64
+	}{cfg, c.config.Threshold})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to render query")
+	}
+	query := buf.String()
+
+	log.Printf("\n=== Running %s check", strings.ToLower(c.config.Name))
+
+	response, err := c.grafanaClient.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	var failing []string
+	affectedNodes := make([]string, 0)
+	nodeSet := make(map[string]bool)
+	for _, frame := range response.Results.PandaPulse.Frames {
+		for _, field := range frame.Schema.Fields {
+			values := make([]string, 0, len(c.config.Labels))
+			for _, key := range c.config.Labels {
+				if field.Labels[key] == "" {
+					break
+				}
+				values = append(values, fmt.Sprintf("%s=%s", key, field.Labels[key]))
+			}
+			if len(values) < len(c.config.Labels) {
+				continue
+			}
+
+			failing = append(failing, strings.Join(values, ", "))
+			log.Printf("  - Failing: %s", strings.Join(values, ", "))
+
+			node := field.Labels[c.config.Labels[0]]
+			if !nodeSet[node] {
+				affectedNodes = append(affectedNodes, node)
+				nodeSet[node] = true
+			}
+		}
+	}
+
+	if len(failing) == 0 {
+		log.Printf("  - %s", c.config.OKDescription)
+
+		return &checks.Result{
+			Name:        c.Name(),
+			Category:    c.Category(),
+			Status:      checks.StatusOK,
+			Description: c.config.OKDescription,
+			Timestamp:   time.Now(),
+			Details: map[string]interface{}{
+				"query": query,
+			},
+			AffectedNodes: []string{},
+		}, nil
+	}
+
+	return &checks.Result{
+		Name:        c.Name(),
+		Category:    c.Category(),
+		Status:      checks.StatusFail,
+		Description: c.config.FailDescription,
+		Timestamp:   time.Now(),
+		Details: map[string]interface{}{
+			"query":   query,
+			"failing": strings.Join(failing, "\n"),
+		},
+		AffectedNodes: affectedNodes,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package checks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/grafana"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+)
+
+// failingAttestations is a Grafana response for a query that returned a series for one node.
+const failingAttestations = `{
+	"results": {
+		"pandaPulse": {
+			"frames": [{
+				"schema": {
+					"fields": [
+						{"name": "Time"},
+						{"name": "Value", "labels": {"instance": "cl-1-prysm-geth"}}
+					]
+				},
+				"data": {"values": [[1700000000000], [142]]}
+			}]
+		}
+	}
+}`
+
+// fakeGrafanaClient returns a canned response and records the queries it was given.
+type fakeGrafanaClient struct {
+	grafana.Client
+	response string
+	queries  []string
+}
+
+func (c *fakeGrafanaClient) Query(ctx context.Context, query string) (*grafana.QueryResponse, error) {
+	c.queries = append(c.queries, query)
+	var response grafana.QueryResponse
+	if err := json.Unmarshal([]byte(c.response), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func findPromQLCheck(t *testing.T, configs []PromQLCheckConfig, name string) PromQLCheckConfig {
+	t.Helper()
+	for _, config := range configs {
+		if config.Name == name {
+			return config
+		}
+	}
+	t.Fatalf("no check named %q", name)
+	return PromQLCheckConfig{}
+}
+
+func TestPromQLCheckFailsOnSeries(t *testing.T) {
+	configs, err := LoadPromQLChecks("")
+	if err != nil {
+		t.Fatalf("LoadPromQLChecks() error = %v", err)
+	}
+	config := findPromQLCheck(t, configs, "Validators failing attestations")
+
+	client := &fakeGrafanaClient{response: failingAttestations}
+	result, err := NewPromQLCheck(client, config).Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{ConsensusNode: "prysm"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if result.Status != checks.StatusFail {
+		t.Errorf("Status = %v, want %v", result.Status, checks.StatusFail)
+	}
+	if len(result.AffectedNodes) != 1 || result.AffectedNodes[0] != "cl-1-prysm-geth" {
+		t.Errorf("AffectedNodes = %v, want [cl-1-prysm-geth]", result.AffectedNodes)
+	}
+	want := `sum by(instance)(increase(validator_failed_attestations{client_name=~"prysm"}[5m])) > 100`
+	if len(client.queries) != 1 || strings.TrimSpace(client.queries[0]) != want {
+		t.Errorf("queries = %q, want [%q]", client.queries, want)
+	}
+}
+
+func TestPromQLCheckPassesWithoutSeries(t *testing.T) {
+	configs, err := LoadPromQLChecks("")
+	if err != nil {
+		t.Fatalf("LoadPromQLChecks() error = %v", err)
+	}
+	config := findPromQLCheck(t, configs, "Validators failing proposals")
+
+	client := &fakeGrafanaClient{response: `{"results": {"pandaPulse": {"frames": []}}}`}
+	result, err := NewPromQLCheck(client, config).Run(context.Background(), logger.NewCheckLogger("test"), checks.Config{ConsensusNode: "prysm"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Status != checks.StatusOK {
+		t.Errorf("Status = %v, want %v", result.Status, checks.StatusOK)
+	}
+}
+
+func TestLoadPromQLChecksReplacesByName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checks.yaml")
+	data := `checks:
+  - name: Validators failing proposals
+    query: sum by(instance)(increase(validator_failed_proposals[5m])) > {{.Threshold}}
+    threshold: 5
+    labels: [instance]
+  - name: Slashings
+    query: increase(validator_slashed_total[5m]) > 0
+    labels: [instance]
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := LoadPromQLChecks(path)
+	if err != nil {
+		t.Fatalf("LoadPromQLChecks() error = %v", err)
+	}
+	if len(configs) != 3 {
+		t.Fatalf("got %d checks, want 3", len(configs))
+	}
+	if proposals := findPromQLCheck(t, configs, "Validators failing proposals"); proposals.Threshold != 5 {
+		t.Errorf("replaced threshold = %g, want 5", proposals.Threshold)
+	}
+	if slashings := findPromQLCheck(t, configs, "Slashings"); slashings.Category != string(checks.CategoryGeneral) || slashings.ClientType != "cl" {
+		t.Errorf("defaults = %q, %q, want general, cl", slashings.Category, slashings.ClientType)
+	}
+}
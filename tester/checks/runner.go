@@ -1,19 +1,82 @@
 package checks
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethpandaops/panda-pulse/pkg/checks"
-	"github.com/ethpandaops/panda-pulse/pkg/clients"
 	"github.com/ethpandaops/panda-pulse/pkg/grafana"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
 )
 
-func SetupRunner(grafanaBaseURL string, grafanaToken string, datasourceID string) (checks.Runner, error) {
+// Node is a consensus client that checks query directly through its beacon API rather than through
+// Prometheus.
+type Node struct {
+	// Name is reported in the results of checks that fail for the node.
+	Name      string
+	BeaconURL string
+	// MetricsURL is where the node's Prometheus metrics are scraped from, if it exports them.
+	MetricsURL string
+}
+
+// nodeFailure returns the failing result of a check whose query to the node under test failed. A
+// node too starved to answer its own API is failing, so this isn't an error of the check.
+func nodeFailure(check checks.Check, log *logger.CheckLogger, node Node, err error) *checks.Result {
+	log.Printf("  - %s didn't answer: %v", node.Name, err)
+
+	return &checks.Result{
+		Name:          check.Name(),
+		Category:      check.Category(),
+		Status:        checks.StatusFail,
+		Description:   fmt.Sprintf("%s didn't answer: %v", node.Name, err),
+		Timestamp:     time.Now(),
+		Details:       map[string]interface{}{"error": err.Error()},
+		AffectedNodes: []string{node.Name},
+	}
+}
+
+// Options configures the checks that query nodes directly.
+type Options struct {
+	// ConsensusClients are the clients, e.g. prysm, whose metrics the Grafana checks query.
+	ConsensusClients []string
+	// PromQLChecks are the declarative checks to register, usually from LoadPromQLChecks.
+	PromQLChecks []PromQLCheckConfig
+	// Node is the service under test.
+	Node Node
+	// GossipPercentile and GossipDeadline set how late blocks and sidecars may arrive. If zero,
+	// DefaultGossipPercentile and the attestation deadline are used.
+	GossipPercentile float64
+	GossipDeadline   time.Duration
+	// PeerThresholds sets how far Node's peers may degrade from before the test.
+	PeerThresholds PeerThresholds
+	// Reference is a healthy node that decides which blocks Node must have and which of Node's
+	// Validators missed proposals, which are only checked if both are set.
+	Reference  Node
+	Validators []uint64
+	// Clock paces the background listeners' retries. If nil, the real clock is used.
+	Clock Clock
+}
+
+// SetupRunner registers the checks that decide whether a step passed. Checks that listen to nodes in
+// the background stop when ctx is cancelled.
+func SetupRunner(ctx context.Context, grafanaBaseURL string, grafanaToken string, datasourceID string, options Options) (checks.Runner, error) {
+	// Queries match the client with a regular expression, so several clients are alternatives, and
+	// no clients means any.
+	consensusNode := strings.Join(options.ConsensusClients, "|")
+	switch len(options.ConsensusClients) {
+	case 0:
+		consensusNode = ".*"
+	case 1:
+	default:
+		consensusNode = "(" + consensusNode + ")"
+	}
 	runner := checks.NewDefaultRunner(checks.Config{
-		Network: "kurtosis",
-		// RunChecks
-		ConsensusNode: clients.CLPrysm,
+		Network:       "kurtosis",
+		ConsensusNode: consensusNode,
 	})
 
 	httpClient := &http.Client{}
@@ -31,8 +94,15 @@ func SetupRunner(grafanaBaseURL string, grafanaToken string, datasourceID string
 	// runner.RegisterCheck(checks.NewCLFinalizedEpochCheck(grafanaClient))
 	runner.RegisterCheck(checks.NewELSyncCheck(grafanaClient))
 	runner.RegisterCheck(checks.NewELBlockHeightCheck(grafanaClient))
-	runner.RegisterCheck(NewFailedAttestationsCheck(grafanaClient))
-	runner.RegisterCheck(NewFailedProposalsCheck(grafanaClient))
+	for _, config := range options.PromQLChecks {
+		runner.RegisterCheck(NewPromQLCheck(grafanaClient, config))
+	}
+	runner.RegisterCheck(NewBlobAvailabilityCheck(ctx, options.Node, options.Reference))
+	runner.RegisterCheck(NewGossipLatencyCheck(ctx, options.Node, options.Reference, options.GossipPercentile, options.GossipDeadline, options.Clock))
+	runner.RegisterCheck(NewPeerHealthCheck(options.Node, options.PeerThresholds))
+	if options.Reference.BeaconURL != "" && len(options.Validators) > 0 {
+		runner.RegisterCheck(NewMissedProposalsCheck(options.Node, options.Reference, options.Validators))
+	}
 
 	return runner, nil
 }
@@ -0,0 +1,226 @@
+package tester
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for the tests, so that step scheduling can be driven by a fake clock
+// instead of waiting for real epochs.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// sleepContext sleeps for d on clock, returning false as soon as ctx is cancelled instead.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	slept := make(chan struct{})
+	go func() {
+		clock.Sleep(d)
+		close(slept)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-slept:
+		return true
+	}
+}
+
+// RealClock is a Clock backed by the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock is a Clock that only moves when Advance or Set is called. Sleepers and tickers fire as
+// the clock passes their deadlines. BlockUntil lets a test wait for the code under test to be
+// waiting on the clock before advancing it.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	// blocked counts the waiters that a goroutine is waiting on, and changed is closed whenever it
+	// changes.
+	blocked int
+	changed chan struct{}
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	// period is zero for one-shot waiters such as sleeps.
+	period  time.Duration
+	ch      chan time.Time
+	stopped bool
+	blocked bool
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// setBlocked records whether a goroutine is waiting on the waiter. c.mu must be held.
+func (c *FakeClock) setBlocked(waiter *fakeWaiter, blocked bool) {
+	if waiter.blocked == blocked {
+		return
+	}
+	waiter.blocked = blocked
+	if blocked {
+		c.blocked++
+	} else {
+		c.blocked--
+	}
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// BlockUntil waits until at least n goroutines are sleeping or waiting for a tick, or ctx is
+// cancelled. A ticker counts as waited on from when its C method is called until it ticks.
+func (c *FakeClock) BlockUntil(ctx context.Context, n int) error {
+	for {
+		c.mu.Lock()
+		blocked, changed := c.blocked, c.changed
+		c.mu.Unlock()
+		if blocked >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	waiter := c.addWaiter(d, 0)
+	<-waiter.ch
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return &fakeTicker{clock: c, waiter: c.addWaiter(d, d)}
+}
+
+// addWaiter adds a waiter that fires after d, and then every period if period isn't zero. A one-shot
+// waiter is counted as blocked straight away, under the same lock, so that Set can't fire it before
+// it's counted and leave it counted forever.
+func (c *FakeClock) addWaiter(d time.Duration, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waiter := &fakeWaiter{
+		deadline: c.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, waiter)
+	if period == 0 {
+		c.setBlocked(waiter, true)
+	}
+	return waiter
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, firing every sleeper and ticker whose deadline has passed. Like
+// time.Ticker, a ticker that isn't drained drops ticks rather than queueing them.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	waiters := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		for !waiter.stopped && !waiter.deadline.After(c.now) {
+			select {
+			case waiter.ch <- waiter.deadline:
+				c.setBlocked(waiter, false)
+			default:
+			}
+
+			if waiter.period == 0 {
+				waiter.stopped = true
+				break
+			}
+			waiter.deadline = waiter.deadline.Add(waiter.period)
+		}
+
+		if !waiter.stopped {
+			waiters = append(waiters, waiter)
+		}
+	}
+	c.waiters = waiters
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	// A tick that is already waiting will be received without blocking.
+	if !t.waiter.stopped && len(t.waiter.ch) == 0 {
+		t.clock.setBlocked(t.waiter, true)
+	}
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.waiter.stopped = true
+	t.clock.setBlocked(t.waiter, false)
+}
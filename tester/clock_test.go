@@ -0,0 +1,59 @@
+package tester
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := NewFakeClock(testGenesis)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := clock.BlockUntil(ctx, 1); err == nil {
+		t.Fatal("BlockUntil() returned before anything waited on the clock")
+	}
+
+	ticks := make(chan time.Time)
+	go func() {
+		for i := 0; i < 3; i++ {
+			ticks <- <-ticker.C()
+		}
+	}()
+
+	for i := 1; i <= 3; i++ {
+		if err := clock.BlockUntil(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+		if got, want := <-ticks, testGenesis.Add(time.Duration(i)*time.Second); !got.Equal(want) {
+			t.Errorf("tick %d = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestFakeClockSleepIsBlockedWhenAdded(t *testing.T) {
+	clock := NewFakeClock(testGenesis)
+	blocked := func() int {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return clock.blocked
+	}
+
+	// A sleep is counted from the moment it's added, so advancing the clock before the sleeper
+	// starts waiting can't leave it counted once it has fired.
+	waiter := clock.addWaiter(time.Second, 0)
+	if got := blocked(); got != 1 {
+		t.Fatalf("%d waiters blocked after adding a sleep, want 1", got)
+	}
+	clock.Advance(time.Second)
+	if got := blocked(); got != 0 {
+		t.Errorf("%d waiters blocked after the sleep fired, want 0", got)
+	}
+	if got := <-waiter.ch; !got.Equal(testGenesis.Add(time.Second)) {
+		t.Errorf("sleep fired at %s, want %s", got, testGenesis.Add(time.Second))
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
 	"github.com/niran/blob-benchmarks/tester"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli/v3"
 )
 
@@ -26,6 +31,126 @@ func main() {
 				Usage:    "The name of a running enclave to use",
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "A file to write the JSON results of the test to",
+			},
+			&cli.StringSliceFlag{
+				Name:    "critical-checks",
+				Aliases: []string{"cc"},
+				Usage:   "The names of the checks that fail a step for the service under test (default: all checks)",
+			},
+			&cli.StringFlag{
+				Name:  "checks-file",
+				Usage: "A YAML file of PromQL checks to add to the default ones, replacing any with the same name",
+			},
+			&cli.FloatFlag{
+				Name:  "gossip-percentile",
+				Usage: "The percentile of block and sidecar arrival times that must be within --gossip-deadline",
+				Value: 95,
+			},
+			&cli.DurationFlag{
+				Name:  "gossip-deadline",
+				Usage: "How long after the start of a slot blocks and sidecars must arrive (default: the attestation deadline, a third of a slot)",
+			},
+			&cli.FloatFlag{
+				Name:  "min-peer-ratio",
+				Usage: "The fraction of the service under test's connected peers from before the test that must remain",
+				Value: 0.5,
+			},
+			&cli.FloatFlag{
+				Name:  "min-mesh-ratio",
+				Usage: "The fraction of the service under test's mesh peers on each topic from before the test that must remain",
+				Value: 0.5,
+			},
+			&cli.FloatFlag{
+				Name:  "max-score-drop",
+				Usage: "How far the average gossipsub score the service under test gives its peers may fall from before the test",
+				Value: 20,
+			},
+			&cli.StringFlag{
+				Name:    "fork",
+				Aliases: []string{"f"},
+				Usage:   "The fork that must be active before the test starts, e.g. fulu. If unset, the test starts at the next epoch",
+			},
+			&cli.IntFlag{
+				Name:    "epochs-per-step",
+				Aliases: []string{"eps"},
+				Usage:   "The number of epochs to hold each bandwidth or blob count for",
+				Value:   2,
+			},
+			&cli.DurationFlag{
+				Name:  "latency",
+				Usage: "The delay to add to packets sent by the service under test, e.g. 100ms",
+			},
+			&cli.DurationFlag{
+				Name:  "jitter",
+				Usage: "The random variation in the added delay, e.g. 20ms (requires --latency)",
+			},
+			&cli.FloatFlag{
+				Name:  "loss",
+				Usage: "The percentage of packets sent by the service under test to drop",
+			},
+			&cli.FloatFlag{
+				Name:  "duplicate",
+				Usage: "The percentage of packets sent by the service under test to duplicate",
+			},
+			&cli.FloatFlag{
+				Name:  "reorder",
+				Usage: "The percentage of packets sent by the service under test to send out of order (requires --latency)",
+			},
+			&cli.StringFlag{
+				Name:  "download-limiter",
+				Usage: "How to limit download bandwidth: police (drop excess packets) or ifb (queue and shape them)",
+				Value: string(tester.DownloadLimiterPolice),
+			},
+			&cli.DurationFlag{
+				Name:  "download-latency",
+				Usage: "The delay to add to packets received by the service under test (requires --download-limiter ifb)",
+			},
+			&cli.DurationFlag{
+				Name:  "download-jitter",
+				Usage: "The random variation in the added download delay (requires --download-latency)",
+			},
+			&cli.FloatFlag{
+				Name:  "download-loss",
+				Usage: "The percentage of packets received by the service under test to drop (requires --download-limiter ifb)",
+			},
+			&cli.StringFlag{
+				Name:  "scope",
+				Usage: "Which traffic to shape: all, cl-p2p (the consensus client's p2p traffic) or el-p2p (its execution client's p2p traffic)",
+				Value: string(tester.ScopeAll),
+			},
+			&cli.StringSliceFlag{
+				Name:  "peer",
+				Usage: "Limit traffic sent to matching services separately, e.g. 'cl-2-*:bandwidth=10mbit:latency=80ms' (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "service",
+				Usage: "The consensus client service to check and shape",
+				Value: tester.DefaultServiceUnderTest,
+			},
+			&cli.StringFlag{
+				Name:  "reference",
+				Usage: "The consensus client whose view of the chain decides whether the service under test missed proposals (default: the first unshaped one from another participant)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "validators",
+				Usage: "The validator indices run by the service under test, e.g. '0-63' (default: read from the enclave's validator ranges)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "group",
+				Usage: "Shape a group of other services throughout the test, e.g. 'slow:percent=30:bandwidth=10mbit' or 'lh:client=lighthouse:latency=100ms' (repeatable)",
+			},
+			&cli.UintFlag{
+				Name:  "seed",
+				Usage: "The random seed for --group picks and bandwidth distributions (default: a random seed, which is logged and reported)",
+			},
+			&cli.StringFlag{
+				Name:  "interface",
+				Usage: "The network interface to shape in the service under test (default: the one with its private IP address)",
+			},
 		},
 		Commands: []*cli.Command{
 			{
@@ -38,11 +163,11 @@ func main() {
 						Usage:   "The number of blobs per block",
 						Value:   6,
 					},
-					&cli.IntFlag{
+					&cli.StringFlag{
 						Name:    "bandwidth",
 						Aliases: []string{"bw"},
-						Usage:   "The initial bandwidth in bits per second (underscores ok)",
-						Value:   50_000_000,
+						Usage:   "The initial bandwidth, e.g. 50mbit or 6.25MB/s",
+						Value:   "50mbit",
 					},
 					&cli.IntFlag{
 						Name:    "delta",
@@ -50,11 +175,23 @@ func main() {
 						Usage:   "The percentage to decrease the bandwidth by each iteration",
 						Value:   50,
 					},
-					&cli.IntFlag{
+					&cli.StringFlag{
 						Name:    "min-bandwidth",
 						Aliases: []string{"mb"},
-						Usage:   "The minimum bandwidth to maintain in bits per second (underscores ok)",
-						Value:   500_000,
+						Usage:   "The minimum bandwidth to maintain",
+						Value:   "500kbit",
+					},
+					&cli.StringFlag{
+						Name:    "search",
+						Aliases: []string{"s"},
+						Usage:   "The search strategy to use: geometric or bisect",
+						Value:   string(tester.SearchGeometric),
+					},
+					&cli.StringFlag{
+						Name:    "precision",
+						Aliases: []string{"p"},
+						Usage:   "The bandwidth range at which bisection stops",
+						Value:   "100kbit",
 					},
 				},
 				Action: minBandwidth,
@@ -64,11 +201,11 @@ func main() {
 				Usage:  "Determine the maximum number of blobs per block that can be sustained by a node given a target bandwidth",
 				Action: maxBlobs,
 				Flags: []cli.Flag{
-					&cli.IntFlag{
+					&cli.StringFlag{
 						Name:    "bandwidth",
 						Aliases: []string{"bw"},
-						Usage:   "The target node's bandwidth in megabits per second",
-						Value:   50,
+						Usage:   "The target node's bandwidth, e.g. 50mbit",
+						Value:   "50mbit",
 					},
 					&cli.IntFlag{
 						Name:    "blobs",
@@ -82,6 +219,55 @@ func main() {
 						Usage:   "The percentage to increase the blob count by each iteration",
 						Value:   100,
 					},
+					&cli.IntFlag{
+						Name:    "max-blobs",
+						Aliases: []string{"mx"},
+						Usage:   "The maximum number of blobs per block to try",
+						Value:   72,
+					},
+					&cli.StringFlag{
+						Name:  "spammer-private-key",
+						Usage: "The private key of the pre-funded account the blob spammer sends from, whose blobs are the only ones counted as included",
+						Value: tester.DefaultBlobSpammerPrivateKey,
+					},
+				},
+			},
+			{
+				Name:   "trace",
+				Usage:  "Replay a trace of bandwidth, latency and loss against the service under test",
+				Action: trace,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Usage:    "A CSV or JSON trace with slot (or time), upload, download, latency, jitter and loss fields",
+						Required: true,
+					},
+				},
+			},
+			{
+				Name:   "partition",
+				Usage:  "Cut the service under test off from its peers, then measure how long it takes to recover",
+				Action: partition,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "isolate",
+						Usage: "Patterns matching the services to cut off (default: the service under test)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "from",
+						Usage: "Patterns matching the services to cut them off from",
+						Value: []string{"cl-*"},
+					},
+					&cli.IntFlag{
+						Name:  "partition-epochs",
+						Usage: "The number of epochs the partition lasts",
+						Value: 2,
+					},
+					&cli.IntFlag{
+						Name:  "recovery-epochs",
+						Usage: "The maximum number of epochs to wait for the checks to pass after healing",
+						Value: 8,
+					},
 				},
 			},
 		},
@@ -96,45 +282,338 @@ func main() {
 func minBandwidth(ctx context.Context, cmd *cli.Command) error {
 	log.Info("Starting blob-benchmarks")
 
+	enclaveContext, err := getEnclaveContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	strategy, err := tester.ParseSearchStrategy(cmd.String("search"))
+	if err != nil {
+		return err
+	}
+
+	bandwidth, err := getBandwidth(cmd, "bandwidth")
+	if err != nil {
+		return err
+	}
+	minBandwidth, err := getBandwidth(cmd, "min-bandwidth")
+	if err != nil {
+		return err
+	}
+	precision, err := getBandwidth(cmd, "precision")
+	if err != nil {
+		return err
+	}
+	if precision == 0 {
+		return fmt.Errorf("--precision must be above 0bit")
+	}
+
+	options, err := getTestOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	test := tester.NewMinBandwidthTest(enclaveContext, uint(cmd.Int("blobs")), bandwidth, minBandwidth, uint(cmd.Int("delta")), strategy, precision, options)
+	err = runTest(enclaveContext, test.Run, func() {
+		cleanupBandwidthControls(enclaveContext, options)
+	})
+
+	lastPassing, firstFailing := test.Bounds()
+	log.Info("Minimum bandwidth bounds", "last_passing", lastPassing.String(), "first_failing", firstFailing.String())
+	writeReport(cmd, test.Report())
+	return err
+}
+
+func maxBlobs(ctx context.Context, cmd *cli.Command) error {
+	log.Info("Starting blob-benchmarks")
+
+	enclaveContext, err := getEnclaveContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	bandwidth, err := getBandwidth(cmd, "bandwidth")
+	if err != nil {
+		return err
+	}
+
+	options, err := getTestOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	test := tester.NewMaxBlobsTest(enclaveContext, bandwidth, uint(cmd.Int("blobs")), uint(cmd.Int("max-blobs")), uint(cmd.Int("delta")), cmd.String("spammer-private-key"), options)
+	err = runTest(enclaveContext, test.Run, func() {
+		log.Info("Stopping blob spammer...")
+		if err := tester.StopBlobSpammer(context.Background(), enclaveContext); err != nil {
+			log.Error("Failed to stop blob spammer", "error", err)
+		}
+
+		cleanupBandwidthControls(enclaveContext, options)
+	})
+
+	log.Info("Maximum sustainable blobs per block", "blobs", test.SustainableBlobsPerBlock())
+	writeReport(cmd, test.Report())
+	return err
+}
+
+func trace(ctx context.Context, cmd *cli.Command) error {
+	log.Info("Starting blob-benchmarks")
+
+	points, err := tester.LoadTrace(cmd.String("file"))
+	if err != nil {
+		return err
+	}
+
+	enclaveContext, err := getEnclaveContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	options, err := getTestOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	test := tester.NewTraceReplayTest(enclaveContext, points, options)
+	err = runTest(enclaveContext, test.Run, func() {
+		cleanupBandwidthControls(enclaveContext, options)
+	})
+
+	log.Info("Trace replay steps that passed", "steps", test.PassingSteps())
+	writeReport(cmd, test.Report())
+	return err
+}
+
+func partition(ctx context.Context, cmd *cli.Command) error {
+	log.Info("Starting blob-benchmarks")
+
+	enclaveContext, err := getEnclaveContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	options, err := getTestOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	test := tester.NewPartitionTest(enclaveContext, cmd.StringSlice("isolate"), cmd.StringSlice("from"), uint(cmd.Int("partition-epochs")), uint(cmd.Int("recovery-epochs")), options)
+	err = runTest(enclaveContext, test.Run, func() {
+		log.Info("Healing partition...")
+		test.Heal()
+	})
+
+	log.Info("Epochs to recover after healing", "epochs", test.RecoveryEpochs())
+	writeReport(cmd, test.Report())
+	return err
+}
+
+func writeReport(cmd *cli.Command, report *tester.Report) {
+	path := cmd.String("output")
+	if path == "" {
+		return
+	}
+
+	if err := report.WriteFile(path); err != nil {
+		log.Error("Failed to write report", "error", err)
+		return
+	}
+	log.Info("Wrote report", "path", path)
+}
+
+func getEnclaveContext(ctx context.Context, cmd *cli.Command) (*enclaves.EnclaveContext, error) {
 	var enclaveContext *enclaves.EnclaveContext
 	var err error
 	if cmd.String("enclave") != "" {
 		enclaveContext, err = tester.GetEnclaveContext(ctx, cmd.String("enclave"))
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		enclaveContext, err = tester.GetOnlyEnclaveContext(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	log.Info("Retrieved enclave context", "name", enclaveContext.GetEnclaveName())
+	return enclaveContext, nil
+}
+
+func getTestOptions(cmd *cli.Command) (tester.TestOptions, error) {
+	netem := tester.NetemParams{
+		Latency:   cmd.Duration("latency"),
+		Jitter:    cmd.Duration("jitter"),
+		Loss:      cmd.Float("loss"),
+		Duplicate: cmd.Float("duplicate"),
+		Reorder:   cmd.Float("reorder"),
+	}
+	if err := netem.Validate(); err != nil {
+		return tester.TestOptions{}, errors.Wrap(err, "invalid network emulation flags")
+	}
 
+	downloadLimiter, err := tester.ParseDownloadLimiter(cmd.String("download-limiter"))
+	if err != nil {
+		return tester.TestOptions{}, err
+	}
+
+	downloadNetem := tester.NetemParams{
+		Latency: cmd.Duration("download-latency"),
+		Jitter:  cmd.Duration("download-jitter"),
+		Loss:    cmd.Float("download-loss"),
+	}
+	if err := downloadNetem.Validate(); err != nil {
+		return tester.TestOptions{}, errors.Wrap(err, "invalid download network emulation flags")
+	}
+	if !downloadNetem.IsZero() && downloadLimiter != tester.DownloadLimiterIFB {
+		return tester.TestOptions{}, fmt.Errorf("download network emulation requires --download-limiter %s", tester.DownloadLimiterIFB)
+	}
+
+	if percentile := cmd.Float("gossip-percentile"); percentile <= 0 || percentile > 100 {
+		return tester.TestOptions{}, fmt.Errorf("--gossip-percentile must be more than 0 and at most 100")
+	}
+
+	for _, name := range []string{"min-peer-ratio", "min-mesh-ratio"} {
+		if ratio := cmd.Float(name); ratio <= 0 || ratio > 1 {
+			return tester.TestOptions{}, fmt.Errorf("--%s must be more than 0 and at most 1", name)
+		}
+	}
+	if cmd.Float("max-score-drop") <= 0 {
+		return tester.TestOptions{}, fmt.Errorf("--max-score-drop must be positive")
+	}
+
+	scope, err := tester.ParseShapingScope(cmd.String("scope"))
+	if err != nil {
+		return tester.TestOptions{}, err
+	}
+
+	var peers []tester.PeerPolicy
+	for _, spec := range cmd.StringSlice("peer") {
+		peer, err := tester.ParsePeerPolicy(spec)
+		if err != nil {
+			return tester.TestOptions{}, err
+		}
+		peers = append(peers, peer)
+	}
+
+	var groups []tester.GroupPolicy
+	for _, spec := range cmd.StringSlice("group") {
+		group, err := tester.ParseGroupPolicy(spec)
+		if err != nil {
+			return tester.TestOptions{}, err
+		}
+		groups = append(groups, group)
+	}
+
+	seed := cmd.Uint("seed")
+	if !cmd.IsSet("seed") && len(groups) > 0 {
+		seed = rand.Uint64()
+		log.Info("Generated random seed", "seed", seed)
+	}
+
+	var validators []uint64
+	for _, value := range cmd.StringSlice("validators") {
+		indices, err := tester.ParseValidatorRange(value)
+		if err != nil {
+			return tester.TestOptions{}, errors.Wrap(err, "invalid --validators")
+		}
+		validators = append(validators, indices...)
+	}
+
+	return tester.TestOptions{
+		CriticalChecks:   cmd.StringSlice("critical-checks"),
+		ChecksFile:       cmd.String("checks-file"),
+		GossipPercentile: cmd.Float("gossip-percentile"),
+		GossipDeadline:   cmd.Duration("gossip-deadline"),
+		MinPeerRatio:     cmd.Float("min-peer-ratio"),
+		MinMeshRatio:     cmd.Float("min-mesh-ratio"),
+		MaxScoreDrop:     cmd.Float("max-score-drop"),
+		Reference:        cmd.String("reference"),
+		Validators:       validators,
+		Fork:             cmd.String("fork"),
+		EpochsPerStep:    uint(cmd.Int("epochs-per-step")),
+		Netem:            netem,
+		DownloadLimiter:  downloadLimiter,
+		DownloadNetem:    downloadNetem,
+		Scope:            scope,
+		Service:          cmd.String("service"),
+		Groups:           groups,
+		Seed:             seed,
+		Peers:            peers,
+		Shaper:           tester.NewTcShaper(cmd.String("interface")),
+	}, nil
+}
+
+// getBandwidth parses a bandwidth flag. Bare numbers below 1kbit are rejected because they're almost
+// always a forgotten unit, e.g. "--bandwidth 50" meaning 50mbit.
+func getBandwidth(cmd *cli.Command, name string) (tester.Bandwidth, error) {
+	value := cmd.String(name)
+	bandwidth, err := tester.ParseBandwidth(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid --%s", name)
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil && bandwidth < 1000 {
+		return 0, fmt.Errorf("--%s %s has no unit and is less than 1kbit; did you mean %smbit?", name, value, value)
+	}
+	return bandwidth, nil
+}
+
+func cleanupBandwidthControls(enclaveContext *enclaves.EnclaveContext, options tester.TestOptions) {
+	log.Info("Cleaning up bandwidth controls...")
+	service, err := tester.GetServiceUnderTest(enclaveContext, options.Service)
+	if err != nil {
+		log.Error("Failed to get service under test", "error", err)
+		return
+	}
+
+	target, _, err := tester.ResolveScope(enclaveContext, service, options.Scope)
+	if err != nil {
+		log.Error("Failed to resolve shaping scope", "error", err)
+		return
+	}
+
+	if err := options.Shaper.Remove(target); err != nil {
+		log.Error("Failed to remove bandwidth limits", "error", err)
+	}
+
+	// Groups are selected deterministically, so resolving them again finds the same services.
+	groups, err := tester.ResolveGroups(enclaveContext, service, options)
+	if err != nil {
+		log.Error("Failed to resolve service groups", "error", err)
+		return
+	}
+	tester.RemoveGroups(options.Shaper, groups)
+}
+
+// runTest runs the test in the background until it completes, fails or the process is interrupted,
+// then stops it and runs the cleanup function.
+func runTest(enclaveContext *enclaves.EnclaveContext, run func(context.Context, chan struct{}) error, cleanup func()) error {
 	// TODO: If we created an enclave, defer its deletion.
 	createdEnclave := false
 	if createdEnclave {
 		defer tester.CleanupEnclave(enclaveContext)
 	}
 
-	testDoneChannel := make(chan struct{})
+	// A failed test returns rather than exiting so that the cleanup still removes its limits and
+	// partitions.
+	ctx, cancel := context.WithCancel(context.Background())
+	testDoneChannel := make(chan struct{}, 1)
+	testErrChannel := make(chan error, 1)
+	testStoppedChannel := make(chan struct{})
 	go func() {
-		test := tester.NewMinBandwidthTest(enclaveContext, uint(cmd.Int("blobs")), uint(cmd.Int("bandwidth")), uint(cmd.Int("min-bandwidth")), uint(cmd.Int("delta")))
-		err = test.Run(testDoneChannel)
-		if err != nil {
-			log.Crit("Test failed", "error", err)
+		defer close(testStoppedChannel)
+		if err := run(ctx, testDoneChannel); err != nil {
+			testErrChannel <- err
 		}
 	}()
 
+	defer cleanup()
+	// An interrupted test is still running, so wait for it to stop before the cleanup removes its
+	// limits and the caller reads its report.
 	defer func() {
-		log.Info("Cleaning up bandwidth controls...")
-		service, err := tester.GetServiceUnderTest(enclaveContext)
-		if err != nil {
-			log.Error("Failed to get service under test", "error", err)
-		}
-
-		tester.RemoveBandwidthControls(service)
+		cancel()
+		<-testStoppedChannel
 	}()
 
 	interruptChannel := make(chan os.Signal, 1)
@@ -145,12 +624,10 @@ func minBandwidth(ctx context.Context, cmd *cli.Command) error {
 		log.Info("Stopping test...")
 	case <-testDoneChannel:
 		log.Info("Test completed.")
+	case err := <-testErrChannel:
+		log.Error("Test failed", "error", err)
+		return errors.Wrap(err, "test failed")
 	}
 
 	return nil
 }
-
-func maxBlobs(ctx context.Context, cmd *cli.Command) error {
-	log.Error("Not implemented")
-	return nil
-}
@@ -0,0 +1,143 @@
+package tester
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DistributionKind is the shape of a bandwidth distribution.
+type DistributionKind string
+
+const (
+	// DistributionUniform samples evenly between Min and Max.
+	DistributionUniform DistributionKind = "uniform"
+	// DistributionLogNormal samples around Median with the spread Sigma, which suits the long tail
+	// of home connections. Min and Max clamp the samples if set.
+	DistributionLogNormal DistributionKind = "lognormal"
+	// DistributionEmpirical samples the bandwidths of a histogram in proportion to their weights.
+	DistributionEmpirical DistributionKind = "empirical"
+)
+
+// HistogramBucket is a bandwidth and the weight of nodes that have it.
+type HistogramBucket struct {
+	Bandwidth Bandwidth `json:"bandwidth"`
+	Weight    float64   `json:"weight"`
+}
+
+// BandwidthDistribution describes how bandwidths are assigned to the members of a group.
+type BandwidthDistribution struct {
+	Kind      DistributionKind  `json:"kind"`
+	Min       Bandwidth         `json:"min,omitempty"`
+	Max       Bandwidth         `json:"max,omitempty"`
+	Median    Bandwidth         `json:"median,omitempty"`
+	Sigma     float64           `json:"sigma,omitempty"`
+	Histogram []HistogramBucket `json:"histogram,omitempty"`
+}
+
+func (d BandwidthDistribution) Validate() error {
+	switch d.Kind {
+	case DistributionUniform:
+		if d.Min == 0 || d.Max < d.Min {
+			return fmt.Errorf("a uniform distribution needs 0 < min <= max")
+		}
+	case DistributionLogNormal:
+		if d.Median == 0 || d.Sigma <= 0 {
+			return fmt.Errorf("a log-normal distribution needs a median and a positive sigma")
+		}
+		if d.Max != 0 && d.Max < d.Min {
+			return fmt.Errorf("max must be at least min")
+		}
+	case DistributionEmpirical:
+		var total float64
+		for _, bucket := range d.Histogram {
+			total += bucket.Weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("an empirical distribution needs a histogram with some weight")
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q, expected %q, %q or %q", d.Kind, DistributionUniform, DistributionLogNormal, DistributionEmpirical)
+	}
+	return nil
+}
+
+// Sample draws a bandwidth.
+func (d BandwidthDistribution) Sample(rng *rand.Rand) Bandwidth {
+	switch d.Kind {
+	case DistributionUniform:
+		return d.Min + Bandwidth(rng.Uint64N(uint64(d.Max-d.Min)+1))
+	case DistributionLogNormal:
+		bandwidth := Bandwidth(math.Round(float64(d.Median) * math.Exp(d.Sigma*rng.NormFloat64())))
+		bandwidth = max(bandwidth, d.Min, 1)
+		if d.Max != 0 {
+			bandwidth = min(bandwidth, d.Max)
+		}
+		return bandwidth
+	case DistributionEmpirical:
+		var total float64
+		for _, bucket := range d.Histogram {
+			total += bucket.Weight
+		}
+		r := rng.Float64() * total
+		for _, bucket := range d.Histogram {
+			if r < bucket.Weight {
+				return bucket.Bandwidth
+			}
+			r -= bucket.Weight
+		}
+		return d.Histogram[len(d.Histogram)-1].Bandwidth
+	}
+	return 0
+}
+
+// LoadHistogram reads a CSV file with bandwidth (bits per second or with units such as "10mbit")
+// and positive weight columns, e.g. the share of stakers on each speed tier.
+func LoadHistogram(path string) ([]HistogramBucket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open histogram")
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read histogram %s", path)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("histogram %s needs a header and at least one bucket", path)
+	}
+
+	bandwidthColumn, weightColumn := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "bandwidth":
+			bandwidthColumn = i
+		case "weight":
+			weightColumn = i
+		}
+	}
+	if bandwidthColumn < 0 || weightColumn < 0 {
+		return nil, fmt.Errorf("histogram %s needs bandwidth and weight columns", path)
+	}
+
+	var buckets []HistogramBucket
+	for i, record := range records[1:] {
+		bandwidth, err := ParseBandwidth(record[bandwidthColumn])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bandwidth on line %d of %s", i+2, path)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(record[weightColumn]), 64)
+		if err != nil || !(weight > 0) || math.IsInf(weight, 1) {
+			return nil, fmt.Errorf("invalid weight on line %d of %s, it must be a positive number", i+2, path)
+		}
+		buckets = append(buckets, HistogramBucket{Bandwidth: bandwidth, Weight: weight})
+	}
+	return buckets, nil
+}
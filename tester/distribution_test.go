@@ -0,0 +1,141 @@
+package tester
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleDistribution(d BandwidthDistribution, seed uint64, n int) []Bandwidth {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	samples := make([]Bandwidth, n)
+	for i := range samples {
+		samples[i] = d.Sample(rng)
+	}
+	return samples
+}
+
+func TestSampleIsReproducible(t *testing.T) {
+	distributions := []BandwidthDistribution{
+		{Kind: DistributionUniform, Min: 1_000_000, Max: 100_000_000},
+		{Kind: DistributionLogNormal, Median: 25_000_000, Sigma: 0.9},
+		{Kind: DistributionEmpirical, Histogram: []HistogramBucket{{10_000_000, 1}, {50_000_000, 2}, {1_000_000_000, 1}}},
+	}
+	for _, d := range distributions {
+		first := sampleDistribution(d, 42, 100)
+		if again := sampleDistribution(d, 42, 100); !reflect.DeepEqual(first, again) {
+			t.Errorf("%s: samples with the same seed differ", d.Kind)
+		}
+		if other := sampleDistribution(d, 43, 100); reflect.DeepEqual(first, other) {
+			t.Errorf("%s: samples with different seeds are the same", d.Kind)
+		}
+	}
+}
+
+func TestSampleStaysInRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		distribution BandwidthDistribution
+		min, max     Bandwidth
+	}{
+		{
+			name:         "uniform",
+			distribution: BandwidthDistribution{Kind: DistributionUniform, Min: 5_000_000, Max: 10_000_000},
+			min:          5_000_000,
+			max:          10_000_000,
+		},
+		{
+			name:         "uniform single value",
+			distribution: BandwidthDistribution{Kind: DistributionUniform, Min: 5_000_000, Max: 5_000_000},
+			min:          5_000_000,
+			max:          5_000_000,
+		},
+		{
+			name:         "log-normal clamped",
+			distribution: BandwidthDistribution{Kind: DistributionLogNormal, Median: 25_000_000, Sigma: 2, Min: 2_000_000, Max: 100_000_000},
+			min:          2_000_000,
+			max:          100_000_000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, sample := range sampleDistribution(tt.distribution, 1, 10_000) {
+				if sample < tt.min || sample > tt.max {
+					t.Fatalf("sample %s is outside [%s, %s]", sample, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestEmpiricalSamplesAreBuckets(t *testing.T) {
+	d := BandwidthDistribution{
+		Kind:      DistributionEmpirical,
+		Histogram: []HistogramBucket{{10_000_000, 1}, {50_000_000, 3}, {1_000_000_000, 0}},
+	}
+	counts := make(map[Bandwidth]int)
+	for _, sample := range sampleDistribution(d, 7, 10_000) {
+		counts[sample]++
+	}
+	for bandwidth := range counts {
+		if bandwidth != 10_000_000 && bandwidth != 50_000_000 {
+			t.Errorf("sample %s isn't a bucket with weight", bandwidth)
+		}
+	}
+	// The heavier bucket is sampled about three times as often.
+	if counts[50_000_000] < 2*counts[10_000_000] {
+		t.Errorf("counts = %v, want 50mbit sampled about three times as often as 10mbit", counts)
+	}
+}
+
+func TestLoadHistogram(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []HistogramBucket
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			content: "bandwidth,weight\n10mbit,0.25\n50mbit,0.5\n1000000000,0.25\n",
+			want:    []HistogramBucket{{10_000_000, 0.25}, {50_000_000, 0.5}, {1_000_000_000, 0.25}},
+		},
+		{
+			name:    "columns in any order",
+			content: "Weight, Bandwidth\n3,25mbit\n",
+			want:    []HistogramBucket{{25_000_000, 3}},
+		},
+		{name: "zero weight", content: "bandwidth,weight\n10mbit,0\n", wantErr: "invalid weight on line 2"},
+		{name: "negative weight", content: "bandwidth,weight\n10mbit,1\n50mbit,-1\n", wantErr: "invalid weight on line 3"},
+		{name: "non-numeric weight", content: "bandwidth,weight\n10mbit,many\n", wantErr: "invalid weight on line 2"},
+		{name: "invalid bandwidth", content: "bandwidth,weight\nfast,1\n", wantErr: "invalid bandwidth on line 2"},
+		{name: "missing column", content: "bandwidth,share\n10mbit,1\n", wantErr: "needs bandwidth and weight columns"},
+		{name: "no buckets", content: "bandwidth,weight\n", wantErr: "needs a header and at least one bucket"},
+		{name: "ragged row", content: "bandwidth,weight\n10mbit\n", wantErr: "failed to read histogram"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "histogram.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadHistogram(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadHistogram() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadHistogram() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadHistogram() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// executionClient is a minimal client for an execution client's JSON-RPC API.
+type executionClient struct {
+	url        string
+	httpClient *http.Client
+}
+
+func newExecutionClient(url string) *executionClient {
+	return &executionClient{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// call calls method and decodes its result into out.
+func (c *executionClient) call(ctx context.Context, method string, params []interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s request", method)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for %s", method)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %s", method)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to call %s: status %d, body: %s", method, resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return errors.Wrapf(err, "failed to decode %s response", method)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("failed to call %s: %s (code %d)", method, response.Error.Message, response.Error.Code)
+	}
+	if err := json.Unmarshal(response.Result, out); err != nil {
+		return errors.Wrapf(err, "failed to decode %s result", method)
+	}
+	return nil
+}
+
+// blobCountFrom returns the number of blobs carried by the transactions sender included in the
+// block with the given hash.
+func (c *executionClient) blobCountFrom(ctx context.Context, blockHash string, sender common.Address) (int, error) {
+	var block *struct {
+		Transactions []struct {
+			From                common.Address `json:"from"`
+			BlobVersionedHashes []string       `json:"blobVersionedHashes"`
+		} `json:"transactions"`
+	}
+	if err := c.call(ctx, "eth_getBlockByHash", []interface{}{blockHash, true}, &block); err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("execution client doesn't have block %s", blockHash)
+	}
+
+	count := 0
+	for _, tx := range block.Transactions {
+		if tx.From == sender {
+			count += len(tx.BlobVersionedHashes)
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,393 @@
+package tester
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// GroupPolicy selects a set of consensus client services and the limits to shape each of them with
+// throughout a test, alongside the service under test.
+type GroupPolicy struct {
+	Name string
+	// Pattern is matched against service names with path.Match. It defaults to "cl-*".
+	Pattern string
+	// FirstParticipant and LastParticipant restrict the group to a range of participant indexes.
+	// Zero means any participant.
+	FirstParticipant uint
+	LastParticipant  uint
+	// Client restricts the group to participants running the client, e.g. "lighthouse" or "reth".
+	Client string
+	// Percent selects that share of the services that match the other selectors, in participant
+	// order unless Random is set. Zero selects all of them.
+	Percent float64
+	// Random picks the Percent of services at random with the test's seed.
+	Random          bool
+	UploadBandwidth Bandwidth
+	// Distribution assigns each member its own upload bandwidth instead of UploadBandwidth.
+	Distribution      *BandwidthDistribution
+	DownloadBandwidth Bandwidth
+	Netem             NetemParams
+}
+
+// ParseGroupPolicy parses a policy of the form "<name>:<key>=<value>:...". The selector keys are
+// pattern, participants (e.g. "3" or "3-8"), client, percent and pick (first or random), and the
+// limit keys are bandwidth and download (e.g. "10mbit"), latency, jitter, loss, duplicate and
+// reorder, e.g. "slow:percent=30:bandwidth=10mbit". Instead of a bandwidth, distribution samples
+// one for each member: uniform with min and max, lognormal with median, sigma and optionally min
+// and max, or empirical with a histogram file.
+func ParseGroupPolicy(s string) (GroupPolicy, error) {
+	parts := strings.Split(s, ":")
+	policy := GroupPolicy{Name: parts[0], Pattern: "cl-*"}
+	if policy.Name == "" || strings.Contains(policy.Name, "=") {
+		return GroupPolicy{}, fmt.Errorf("group policy %q has no name", s)
+	}
+
+	distribution := func() *BandwidthDistribution {
+		if policy.Distribution == nil {
+			policy.Distribution = &BandwidthDistribution{}
+		}
+		return policy.Distribution
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return GroupPolicy{}, fmt.Errorf("expected key=value in group policy %q, got %q", s, part)
+		}
+
+		var err error
+		switch key {
+		case "pattern":
+			policy.Pattern = value
+			_, err = path.Match(value, "")
+		case "participants":
+			first, last, isRange := strings.Cut(value, "-")
+			var n uint64
+			n, err = strconv.ParseUint(first, 10, 64)
+			policy.FirstParticipant, policy.LastParticipant = uint(n), uint(n)
+			if err == nil && isRange {
+				n, err = strconv.ParseUint(last, 10, 64)
+				policy.LastParticipant = uint(n)
+			}
+			if err == nil && policy.LastParticipant < policy.FirstParticipant {
+				err = fmt.Errorf("range %q is backwards", value)
+			}
+		case "client":
+			policy.Client = value
+		case "percent":
+			policy.Percent, err = strconv.ParseFloat(value, 64)
+			if err == nil && (policy.Percent <= 0 || policy.Percent > 100) {
+				err = fmt.Errorf("must be more than 0 and at most 100")
+			}
+		case "pick":
+			switch value {
+			case "first":
+				policy.Random = false
+			case "random":
+				policy.Random = true
+			default:
+				err = fmt.Errorf("expected first or random, got %q", value)
+			}
+		case "bandwidth":
+			policy.UploadBandwidth, err = ParseBandwidth(value)
+		case "distribution":
+			distribution().Kind = DistributionKind(value)
+		case "min":
+			distribution().Min, err = ParseBandwidth(value)
+		case "max":
+			distribution().Max, err = ParseBandwidth(value)
+		case "median":
+			distribution().Median, err = ParseBandwidth(value)
+		case "sigma":
+			distribution().Sigma, err = strconv.ParseFloat(value, 64)
+		case "histogram":
+			distribution().Histogram, err = LoadHistogram(value)
+		case "download":
+			policy.DownloadBandwidth, err = ParseBandwidth(value)
+		default:
+			var isNetem bool
+			isNetem, err = parseNetemField(&policy.Netem, key, value)
+			if !isNetem {
+				return GroupPolicy{}, fmt.Errorf("unknown key %q in group policy %q", key, s)
+			}
+		}
+		if err != nil {
+			return GroupPolicy{}, errors.Wrapf(err, "invalid %s in group policy %q", key, s)
+		}
+	}
+
+	if policy.Distribution != nil {
+		if policy.UploadBandwidth != 0 {
+			return GroupPolicy{}, fmt.Errorf("group policy %q has both a bandwidth and a distribution", s)
+		}
+		if err := policy.Distribution.Validate(); err != nil {
+			return GroupPolicy{}, errors.Wrapf(err, "invalid distribution in group policy %q", s)
+		}
+	} else if policy.UploadBandwidth == 0 && policy.DownloadBandwidth == 0 && policy.Netem.IsZero() {
+		return GroupPolicy{}, fmt.Errorf("group policy %q doesn't limit anything", s)
+	}
+	if policy.Random && policy.Percent == 0 {
+		return GroupPolicy{}, fmt.Errorf("group policy %q picks at random without a percent", s)
+	}
+	if err := policy.Netem.Validate(); err != nil {
+		return GroupPolicy{}, errors.Wrapf(err, "invalid network emulation in group policy %q", s)
+	}
+	return policy, nil
+}
+
+// matches reports whether a service is selected by the policy, before the percentage is applied.
+func (p GroupPolicy) matches(serviceName string) bool {
+	if ok, _ := path.Match(p.Pattern, serviceName); !ok {
+		return false
+	}
+
+	parts := strings.Split(serviceName, "-")
+	if p.FirstParticipant > 0 {
+		if len(parts) < 2 {
+			return false
+		}
+		index, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil || uint(index) < p.FirstParticipant || uint(index) > p.LastParticipant {
+			return false
+		}
+	}
+
+	if p.Client != "" {
+		if len(parts) < 3 {
+			return false
+		}
+		found := false
+		for _, client := range parts[2:] {
+			if client == p.Client {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GroupMember is a service selected by a group policy, and the service shaped on its behalf.
+type GroupMember struct {
+	Service *services.ServiceContext
+	Target  *services.ServiceContext
+	Limits  Limits
+}
+
+// ServiceGroup is the set of services a group policy selected.
+type ServiceGroup struct {
+	Policy  GroupPolicy
+	Members []GroupMember
+}
+
+func (g ServiceGroup) services() []*services.ServiceContext {
+	var result []*services.ServiceContext
+	for _, member := range g.Members {
+		result = append(result, member.Service)
+	}
+	return result
+}
+
+// groupedServices returns the members of all of the groups.
+func groupedServices(groups []ServiceGroup) []*services.ServiceContext {
+	var result []*services.ServiceContext
+	for _, group := range groups {
+		result = append(result, group.services()...)
+	}
+	return result
+}
+
+// GroupSummary is how a group appears in a report.
+type GroupSummary struct {
+	Name         string                 `json:"name"`
+	Distribution *BandwidthDistribution `json:"distribution,omitempty"`
+	Members      []MemberSummary        `json:"members"`
+}
+
+// MemberSummary records the limits assigned to a member of a group, which differ between members
+// when they're sampled from a distribution.
+type MemberSummary struct {
+	Service       string `json:"service"`
+	ShapedService string `json:"shaped_service"`
+	Limits        Limits `json:"limits"`
+}
+
+// GroupResult is a group's verdict for a step.
+type GroupResult struct {
+	Name    string      `json:"name"`
+	Verdict StepVerdict `json:"verdict"`
+}
+
+// participantIndex returns the participant index in a service name such as cl-3-teku-geth, or
+// MaxInt if it has none, so that such services sort last.
+func participantIndex(serviceName string) int {
+	parts := strings.Split(serviceName, "-")
+	if len(parts) < 2 {
+		return math.MaxInt
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return math.MaxInt
+	}
+	return index
+}
+
+func lessByParticipant(a string, b string) bool {
+	if i, j := participantIndex(a), participantIndex(b); i != j {
+		return i < j
+	}
+	return a < b
+}
+
+// ResolveGroups selects the services for each of the options' group policies, other than the service
+// under test, and resolves what to shape for each of them under the scope. A service selected by
+// more than one policy belongs to the first. Random picks and sampled bandwidths are drawn from the
+// options' seed in participant order, so the same enclave and seed always give the same groups.
+func ResolveGroups(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext, options TestOptions) ([]ServiceGroup, error) {
+	if len(options.Groups) == 0 {
+		return nil, nil
+	}
+
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	var names []string
+	for name := range serviceNames {
+		if name != service.GetServiceName() {
+			names = append(names, string(name))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return lessByParticipant(names[i], names[j]) })
+
+	rng := rand.New(rand.NewPCG(options.Seed, 0))
+	selected := make(map[string]bool)
+	var groups []ServiceGroup
+	for _, policy := range options.Groups {
+		var candidates []string
+		for _, name := range names {
+			if !selected[name] && policy.matches(name) {
+				candidates = append(candidates, name)
+			}
+		}
+		if policy.Percent > 0 {
+			n := int(math.Ceil(policy.Percent * float64(len(candidates)) / 100))
+			if policy.Random {
+				rng.Shuffle(len(candidates), func(i, j int) {
+					candidates[i], candidates[j] = candidates[j], candidates[i]
+				})
+				candidates = candidates[:min(n, len(candidates))]
+				sort.Slice(candidates, func(i, j int) bool { return lessByParticipant(candidates[i], candidates[j]) })
+			} else {
+				candidates = candidates[:min(n, len(candidates))]
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("group %q doesn't select any services", policy.Name)
+		}
+
+		group := ServiceGroup{Policy: policy}
+		for _, name := range candidates {
+			selected[name] = true
+
+			member, err := enclaveContext.GetServiceContext(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get service context for %s", name)
+			}
+			target, ports, err := ResolveScope(enclaveContext, member, options.Scope)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to resolve shaping scope for %s", name)
+			}
+
+			uploadBandwidth := policy.UploadBandwidth
+			if policy.Distribution != nil {
+				uploadBandwidth = policy.Distribution.Sample(rng)
+			}
+
+			group.Members = append(group.Members, GroupMember{
+				Service: member,
+				Target:  target,
+				Limits: Limits{
+					UploadBandwidth:   uploadBandwidth,
+					DownloadBandwidth: policy.DownloadBandwidth,
+					DownloadLimiter:   options.DownloadLimiter,
+					Netem:             policy.Netem,
+					Ports:             ports,
+				},
+			})
+		}
+		log.Info("Resolved service group", "group", policy.Name, "services", candidates, "seed", options.Seed)
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// summarizeGroups describes the groups for a report.
+func summarizeGroups(groups []ServiceGroup) []GroupSummary {
+	var summaries []GroupSummary
+	for _, group := range groups {
+		summary := GroupSummary{Name: group.Policy.Name, Distribution: group.Policy.Distribution}
+		for _, member := range group.Members {
+			summary.Members = append(summary.Members, MemberSummary{
+				Service:       string(member.Service.GetServiceName()),
+				ShapedService: string(member.Target.GetServiceName()),
+				Limits:        member.Limits,
+			})
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// applyGroups shapes every member of every group with its group's limits.
+func applyGroups(shaper Shaper, groups []ServiceGroup) error {
+	for _, group := range groups {
+		for _, member := range group.Members {
+			if err := shaper.Apply(member.Target, member.Limits); err != nil {
+				return errors.Wrapf(err, "failed to apply limits of group %q to %s", group.Policy.Name, member.Target.GetServiceName())
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveGroups removes the limits from every member of every group, logging rather than stopping
+// at failures so that as much as possible is cleaned up.
+func RemoveGroups(shaper Shaper, groups []ServiceGroup) {
+	for _, group := range groups {
+		for _, member := range group.Members {
+			if err := shaper.Remove(member.Target); err != nil {
+				log.Error("Failed to remove group limits", "group", group.Policy.Name, "service", member.Target.GetServiceName(), "error", err)
+			}
+		}
+	}
+}
+
+// evaluateGroups decides whether the results of the evaluator's last run pass for each group.
+func evaluateGroups(evaluator *CheckEvaluator, runner checks.Runner, groups []ServiceGroup) []GroupResult {
+	var results []GroupResult
+	for _, group := range groups {
+		results = append(results, GroupResult{
+			Name:    group.Policy.Name,
+			Verdict: evaluator.EvaluateServices(runner, group.services()),
+		})
+	}
+	return results
+}
@@ -0,0 +1,120 @@
+package tester
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+// packageManager is one of the package managers found in client images.
+type packageManager struct {
+	name    string
+	probe   string
+	update  string
+	install string
+}
+
+var packageManagers = []packageManager{
+	{
+		name:    "apt",
+		probe:   "apt-get --version",
+		update:  "apt-get update",
+		install: "apt-get install -y",
+	},
+	{
+		name:    "apk",
+		probe:   "apk --version",
+		install: "apk add --no-cache",
+	},
+	{
+		name:    "dnf",
+		probe:   "dnf --version",
+		install: "dnf install -y",
+	},
+	{
+		name:    "microdnf",
+		probe:   "microdnf --version",
+		install: "microdnf install -y",
+	},
+}
+
+// tool is a set of commands we run in services, along with the packages that provide them for each
+// package manager. It's only considered installed if every probe succeeds.
+type tool struct {
+	name     string
+	probes   []string
+	packages map[string][]string
+}
+
+// The shaper runs ip as well as tc, e.g. to create IFB devices and read interface state, and
+// busybox's ip can't, so iproute2's ip has to be present too.
+var tcTool = tool{
+	name:   "tc and ip",
+	probes: []string{"tc -V", "ip -V"},
+	packages: map[string][]string{
+		"apt":      {"iproute2"},
+		"apk":      {"iproute2"},
+		"dnf":      {"iproute", "iproute-tc"},
+		"microdnf": {"iproute", "iproute-tc"},
+	},
+}
+
+var iptablesTool = tool{
+	name:   "iptables",
+	probes: []string{"iptables -V"},
+	packages: map[string][]string{
+		"apt":      {"iptables"},
+		"apk":      {"iptables"},
+		"dnf":      {"iptables"},
+		"microdnf": {"iptables"},
+	},
+}
+
+func commandExists(service *services.ServiceContext, probe string) bool {
+	_, err := execCommand(service, probe, "run "+probe)
+	return err == nil
+}
+
+// installTool makes sure the tool is available in the service, installing it with whichever package
+// manager the image has if it isn't already there.
+func installTool(service *services.ServiceContext, t tool) error {
+	installed := true
+	for _, probe := range t.probes {
+		installed = installed && commandExists(service, probe)
+	}
+	if installed {
+		log.Debug("Command is already installed", "service", service.GetServiceName(), "command", t.name)
+		return nil
+	}
+
+	for _, manager := range packageManagers {
+		if !commandExists(service, manager.probe) {
+			continue
+		}
+
+		log.Info("Installing command", "service", service.GetServiceName(), "command", t.name, "package_manager", manager.name)
+		commands := []string{manager.install + " " + strings.Join(t.packages[manager.name], " ")}
+		if manager.update != "" {
+			commands = append([]string{manager.update}, commands...)
+		}
+		for _, command := range commands {
+			if _, err := execCommand(service, command, "install "+t.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	image, err := GetServiceImage(service)
+	if err != nil {
+		log.Debug("Failed to get service image", "error", err)
+		image = "unknown"
+	}
+	return fmt.Errorf("%s is not installed in %s (image %s) and no supported package manager (apt, apk, dnf or microdnf) was found; use an image that includes it", t.name, service.GetServiceName(), image)
+}
+
+func installTcCommand(service *services.ServiceContext) error {
+	return installTool(service, tcTool)
+}
@@ -3,6 +3,8 @@ package tester
 import (
 	"context"
 	"fmt"
+	"os/exec"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
@@ -62,11 +64,49 @@ func CleanupEnclave(enclaveContext *enclaves.EnclaveContext) {
 
 }
 
-func GetServiceUnderTest(enclaveContext *enclaves.EnclaveContext) (*services.ServiceContext, error) {
-	service, err := enclaveContext.GetServiceContext("cl-1-prysm-geth")
+// DefaultServiceUnderTest is the consensus client checked and shaped when no other is chosen.
+const DefaultServiceUnderTest = "cl-1-prysm-geth"
+
+func GetServiceUnderTest(enclaveContext *enclaves.EnclaveContext, name string) (*services.ServiceContext, error) {
+	service, err := enclaveContext.GetServiceContext(name)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get service context")
+		return nil, errors.Wrapf(err, "failed to get service context for %s", name)
 	}
 	log.Info("Retrieved service context", "name", service.GetServiceName(), "uuid", service.GetServiceUUID())
 	return service, nil
 }
+
+// GetBeaconAPIURL returns the URL of a consensus client's beacon API, reachable from the host.
+func GetBeaconAPIURL(service *services.ServiceContext) (string, error) {
+	httpPort, ok := service.GetPublicPorts()["http"]
+	if !ok {
+		return "", fmt.Errorf("service %s has no http port", service.GetServiceName())
+	}
+
+	return fmt.Sprintf("http://%s:%d", service.GetMaybePublicIPAddress(), httpPort.GetNumber()), nil
+}
+
+// GetMetricsURL returns the URL of a service's Prometheus metrics, reachable from the host.
+func GetMetricsURL(service *services.ServiceContext) (string, error) {
+	metricsPort, ok := service.GetPublicPorts()["metrics"]
+	if !ok {
+		return "", fmt.Errorf("service %s has no metrics port", service.GetServiceName())
+	}
+
+	return fmt.Sprintf("http://%s:%d/metrics", service.GetMaybePublicIPAddress(), metricsPort.GetNumber()), nil
+}
+
+// ServiceContainerName returns the name of the Docker container Kurtosis runs the service in.
+func ServiceContainerName(service *services.ServiceContext) string {
+	return fmt.Sprintf("%s--%s", service.GetServiceName(), service.GetServiceUUID())
+}
+
+// GetServiceImage returns the image the service's container was started from. The Kurtosis API
+// doesn't expose it, so this asks the local Docker daemon.
+func GetServiceImage(service *services.ServiceContext) (string, error) {
+	output, err := exec.Command("docker", "inspect", "--format", "{{.Config.Image}}", ServiceContainerName(service)).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to inspect service container")
+	}
+	return strings.TrimSpace(string(output)), nil
+}
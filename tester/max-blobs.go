@@ -0,0 +1,248 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/pkg/errors"
+)
+
+type MaxBlobsTestConfig struct {
+	enclaveContext   *enclaves.EnclaveContext
+	bandwidth        Bandwidth
+	blobsPerBlock    uint
+	maxBlobsPerBlock uint
+	delta            uint
+	spammerKey       string
+	options          TestOptions
+}
+
+type MaxBlobsTest struct {
+	cfg                      MaxBlobsTestConfig
+	currentBlobsPerBlock     uint
+	sustainableBlobsPerBlock uint
+	report                   Report
+}
+
+func NewMaxBlobsTest(enclaveContext *enclaves.EnclaveContext, bandwidth Bandwidth, blobsPerBlock uint, maxBlobsPerBlock uint, delta uint, spammerKey string, options TestOptions) *MaxBlobsTest {
+	return &MaxBlobsTest{
+		cfg: MaxBlobsTestConfig{
+			enclaveContext:   enclaveContext,
+			bandwidth:        bandwidth,
+			blobsPerBlock:    blobsPerBlock,
+			maxBlobsPerBlock: maxBlobsPerBlock,
+			delta:            delta,
+			spammerKey:       spammerKey,
+			options:          options,
+		},
+		currentBlobsPerBlock: blobsPerBlock,
+		report:               Report{Test: "max-blobs"},
+	}
+}
+
+// SustainableBlobsPerBlock returns the highest blob count that passed every check, or zero if none
+// did.
+func (t *MaxBlobsTest) SustainableBlobsPerBlock() uint {
+	return t.sustainableBlobsPerBlock
+}
+
+func (t *MaxBlobsTest) Report() *Report {
+	return &t.report
+}
+
+func (t *MaxBlobsTest) nextBlobsPerBlock() uint {
+	increase := t.currentBlobsPerBlock * t.cfg.delta / 100
+	if increase == 0 {
+		increase = 1
+	}
+	return t.currentBlobsPerBlock + increase
+}
+
+func (t *MaxBlobsTest) Run(ctx context.Context, doneChannel chan struct{}) error {
+	// Get the service for the node whose bandwidth we want to limit.
+	service, err := GetServiceUnderTest(t.cfg.enclaveContext, t.cfg.options.service())
+	if err != nil {
+		return errors.Wrap(err, "failed to get service under test")
+	}
+	t.report.Service = string(service.GetServiceName())
+
+	// Depending on the scope, shaping may apply to a different service than the one checked.
+	target, ports, err := ResolveScope(t.cfg.enclaveContext, service, t.cfg.options.Scope)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve shaping scope")
+	}
+	t.report.Scope = t.cfg.options.Scope
+	t.report.ShapedService = string(target.GetServiceName())
+
+	peers, err := ResolvePeerPolicies(t.cfg.enclaveContext, target, t.cfg.options.Peers)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve peer policies")
+	}
+	t.report.Peers = peers
+
+	groups, err := ResolveGroups(t.cfg.enclaveContext, service, t.cfg.options)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve service groups")
+	}
+	t.report.Groups = summarizeGroups(groups)
+	if len(groups) > 0 {
+		seed := t.cfg.options.Seed
+		t.report.Seed = &seed
+	}
+
+	// The checks listen to the service in the background until the test stops.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runner, err := newCheckRunner(ctx, t.cfg.enclaveContext, service, t.cfg.options, groupedServices(groups))
+	if err != nil {
+		return err
+	}
+
+	chainClock, err := GetChainClock(ctx, t.cfg.options.clock(), service)
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain clock")
+	}
+
+	schedule, err := newStepSchedule(chainClock, t.cfg.options.Fork, t.cfg.options.EpochsPerStep)
+	if err != nil {
+		return errors.Wrap(err, "failed to create step schedule")
+	}
+
+	// Blocks can't include more blobs than the spec allows, so higher counts can't be tested.
+	spammer, err := BlobSpammerAddress(t.cfg.spammerKey)
+	if err != nil {
+		return err
+	}
+	load, err := newBlobLoad(ctx, t.cfg.enclaveContext, service, t.cfg.options, groupedServices(groups), spammer)
+	if err != nil {
+		return errors.Wrap(err, "failed to set up blob load measurement")
+	}
+	if specMax := uint(load.spec.MaxBlobsPerBlock(schedule.startEpoch)); specMax > 0 {
+		if t.currentBlobsPerBlock > specMax {
+			return fmt.Errorf("starting blob count %d is above the %d blobs per block the spec allows", t.currentBlobsPerBlock, specMax)
+		}
+		if t.cfg.maxBlobsPerBlock > specMax {
+			log.Warn("Capping the maximum blob count at the spec's limit", "max_blobs_per_block", t.cfg.maxBlobsPerBlock, "spec_max_blobs_per_block", specMax)
+			t.cfg.maxBlobsPerBlock = specMax
+		}
+	}
+
+	shaper := t.cfg.options.shaper()
+	evaluator := NewCheckEvaluator(service, t.cfg.options.CriticalChecks)
+
+	// Pin the upload bandwidth for the duration of the test.
+	limits := Limits{
+		UploadBandwidth:   t.cfg.bandwidth,
+		DownloadBandwidth: defaultDownloadBandwidth,
+		DownloadLimiter:   t.cfg.options.DownloadLimiter,
+		Netem:             t.cfg.options.Netem,
+		DownloadNetem:     t.cfg.options.DownloadNetem,
+		Ports:             ports,
+		Peers:             peers,
+	}
+	if err := shaper.Apply(target, limits); err != nil {
+		return errors.Wrap(err, "failed to apply bandwidth limits")
+	}
+	if err := applyGroups(shaper, groups); err != nil {
+		return err
+	}
+
+	// Replace any spammer left over from a previous run.
+	if err := StopBlobSpammer(ctx, t.cfg.enclaveContext); err != nil {
+		log.Info("No existing blob spammer seems to be running, continuing...", "message", err)
+	}
+
+	if err := StartBlobSpammer(ctx, t.cfg.enclaveContext, load.rpcURL, t.cfg.spammerKey, t.currentBlobsPerBlock); err != nil {
+		return errors.Wrap(err, "failed to start blob spammer")
+	}
+
+	// Start ticking at a slot boundary once the desired fork has been activated.
+	if !schedule.waitForStart(ctx) {
+		return nil
+	}
+	stats := newStatsCollector(shaper, target, chainClock)
+	stats.sample(chainClock.Now())
+	stepStartSlot := chainClock.CurrentSlot()
+	stepCount := uint(0)
+	measureErrors := 0
+	ticker := chainClock.NewTicker(chainClock.SlotDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		now := chainClock.Now()
+		state := stats.sample(now)
+
+		// Increase the blob count at the end of each step
+		if schedule.stepDue(stepCount, now) {
+			verdict, ok := evaluator.EvaluateStep(ctx, runner)
+			if !ok {
+				continue
+			}
+			includedBlobs, blocks, err := load.measure(ctx, stepStartSlot, chainClock.SlotAt(now))
+			if err != nil {
+				measureErrors++
+				if measureErrors >= maxEvaluateErrors {
+					return errors.Wrap(err, "failed to measure included blobs")
+				}
+				log.Error("Failed to measure included blobs", "attempt", measureErrors, "error", err)
+				continue
+			}
+			measureErrors = 0
+
+			t.report.AddStep(StepResult{
+				Epoch:         chainClock.EpochAt(now),
+				Timestamp:     now,
+				Bandwidth:     t.cfg.bandwidth,
+				BlobsPerBlock: t.currentBlobsPerBlock,
+				IncludedBlobs: includedBlobs,
+				Verdict:       verdict,
+				Groups:        evaluateGroups(evaluator, runner, groups),
+				Tc:            state,
+				Stats:         stats.finish(),
+			})
+
+			if !verdict.Passed {
+				log.Info("Checks failed, stopping test", "blobs_per_block", t.currentBlobsPerBlock, "failed_checks", verdict.FailedChecks, "max_sustainable_blobs_per_block", t.sustainableBlobsPerBlock)
+				doneChannel <- struct{}{}
+				return nil
+			}
+
+			// Passing says nothing about a blob count the blocks didn't reach.
+			if includedBlobs < t.currentBlobsPerBlock {
+				log.Info("Blocks didn't include the target blob count, stopping test", "blobs_per_block", t.currentBlobsPerBlock, "included_blobs_per_block", includedBlobs, "blocks", blocks, "max_sustainable_blobs_per_block", t.sustainableBlobsPerBlock)
+				doneChannel <- struct{}{}
+				return nil
+			}
+
+			t.sustainableBlobsPerBlock = t.currentBlobsPerBlock
+			t.report.Result = t.sustainableBlobsPerBlock
+
+			nextBlobsPerBlock := t.nextBlobsPerBlock()
+			if nextBlobsPerBlock > t.cfg.maxBlobsPerBlock {
+				log.Info("Blob count reached maximum threshold, stopping test", "max_sustainable_blobs_per_block", t.sustainableBlobsPerBlock, "max_blobs_per_block", t.cfg.maxBlobsPerBlock)
+				doneChannel <- struct{}{}
+				return nil
+			}
+
+			// The step has already been recorded, so retrying on the next slot would record it again.
+			if err := UpdateBlobSpammer(ctx, t.cfg.enclaveContext, load.rpcURL, t.cfg.spammerKey, nextBlobsPerBlock); err != nil {
+				return errors.Wrapf(err, "failed to update blob spammer to %d blobs per block", nextBlobsPerBlock)
+			}
+			t.currentBlobsPerBlock = nextBlobsPerBlock
+			stepCount++
+
+			// Measure the next step from the moment its limits took effect.
+			stats.sample(chainClock.Now())
+			stepStartSlot = chainClock.CurrentSlot()
+
+			log.Info("Increased blob count", "epoch", chainClock.EpochAt(now), "new_blobs_per_block", t.currentBlobsPerBlock, "next_increase_at", schedule.stepEnd(stepCount).Local().Format("15:04:05"))
+		}
+	}
+}
@@ -2,34 +2,40 @@ package tester
 
 import (
 	"context"
-	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
 	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
-	"github.com/niran/blob-benchmarks/tester/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
 	"github.com/pkg/errors"
 )
 
 const (
-	slotsPerEpoch = 32
-	slotDuration  = 12 * time.Second
+	// The download bandwidth is held at a reasonable fixed value while upload is varied.
+	defaultDownloadBandwidth Bandwidth = 100_000_000
 )
 
 type MinBandwidthTestConfig struct {
 	enclaveContext *enclaves.EnclaveContext
 	blobsPerBlock  uint
-	bandwidth      uint
-	minBandwidth   uint
+	bandwidth      Bandwidth
+	minBandwidth   Bandwidth
 	delta          uint
+	strategy       SearchStrategy
+	precision      Bandwidth
+	options        TestOptions
 }
 
 type MinBandwidthTest struct {
 	cfg              MinBandwidthTestConfig
-	currentBandwidth uint
-	startTime        time.Time
+	currentBandwidth Bandwidth
+	search           *bandwidthSearch
+	ports            []Port
+	peers            []PeerLimits
+	report           Report
 }
 
-func NewMinBandwidthTest(enclaveContext *enclaves.EnclaveContext, blobsPerBlock uint, bandwidth uint, minBandwidth uint, delta uint) *MinBandwidthTest {
+func NewMinBandwidthTest(enclaveContext *enclaves.EnclaveContext, blobsPerBlock uint, bandwidth Bandwidth, minBandwidth Bandwidth, delta uint, strategy SearchStrategy, precision Bandwidth, options TestOptions) *MinBandwidthTest {
 	return &MinBandwidthTest{
 		cfg: MinBandwidthTestConfig{
 			enclaveContext: enclaveContext,
@@ -37,110 +43,182 @@ func NewMinBandwidthTest(enclaveContext *enclaves.EnclaveContext, blobsPerBlock
 			bandwidth:      bandwidth,
 			minBandwidth:   minBandwidth,
 			delta:          delta,
+			strategy:       strategy,
+			precision:      precision,
+			options:        options,
 		},
 		currentBandwidth: bandwidth,
-		startTime:        time.Now(),
+		search:           newBandwidthSearch(strategy, delta, minBandwidth, precision),
+		report:           Report{Test: "min-bandwidth"},
 	}
 }
 
-func NewMinBandwidthTestForOnlyEnclave(ctx context.Context, blobsPerBlock uint, bandwidth uint, minBandwidth uint, delta uint) (*MinBandwidthTest, error) {
+func NewMinBandwidthTestForOnlyEnclave(ctx context.Context, blobsPerBlock uint, bandwidth Bandwidth, minBandwidth Bandwidth, delta uint, strategy SearchStrategy, precision Bandwidth, options TestOptions) (*MinBandwidthTest, error) {
 	enclaveContext, err := GetOnlyEnclaveContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewMinBandwidthTest(enclaveContext, blobsPerBlock, bandwidth, minBandwidth, delta), nil
+	return NewMinBandwidthTest(enclaveContext, blobsPerBlock, bandwidth, minBandwidth, delta, strategy, precision, options), nil
 }
 
-func (t *MinBandwidthTest) getElapsedEpochs() uint {
-	timeSinceStart := time.Since(t.startTime)
-	slotsSinceStart := uint(timeSinceStart / slotDuration)
-	return slotsSinceStart / slotsPerEpoch
+// Bounds returns the lowest bandwidth that passed every check and the highest bandwidth that failed
+// one, either of which is zero if no such step was run.
+func (t *MinBandwidthTest) Bounds() (Bandwidth, Bandwidth) {
+	return t.search.lastPassing, t.search.firstFailing
 }
 
-func (t *MinBandwidthTest) Run(doneChannel chan struct{}) error {
-	grafanaBaseURL, grafanaToken, datasourceID, err := GetGrafanaConfig(t.cfg.enclaveContext)
+func (t *MinBandwidthTest) Report() *Report {
+	return &t.report
+}
+
+func (t *MinBandwidthTest) limits(uploadBandwidth Bandwidth) Limits {
+	return Limits{
+		UploadBandwidth:   uploadBandwidth,
+		DownloadBandwidth: defaultDownloadBandwidth,
+		DownloadLimiter:   t.cfg.options.DownloadLimiter,
+		Netem:             t.cfg.options.Netem,
+		DownloadNetem:     t.cfg.options.DownloadNetem,
+		Ports:             t.ports,
+		Peers:             t.peers,
+	}
+}
+
+func (t *MinBandwidthTest) Run(ctx context.Context, doneChannel chan struct{}) error {
+	// Get the service for the node whose bandwidth we want to limit.
+	service, err := GetServiceUnderTest(t.cfg.enclaveContext, t.cfg.options.service())
 	if err != nil {
-		return errors.Wrap(err, "failed to get grafana config")
+		return errors.Wrap(err, "failed to get service under test")
 	}
+	t.report.Service = string(service.GetServiceName())
 
-	runner, err := checks.SetupRunner(grafanaBaseURL, grafanaToken, datasourceID)
+	// Depending on the scope, shaping may apply to a different service than the one checked.
+	target, ports, err := ResolveScope(t.cfg.enclaveContext, service, t.cfg.options.Scope)
 	if err != nil {
-		return errors.Wrap(err, "failed to setup runner")
+		return errors.Wrap(err, "failed to resolve shaping scope")
 	}
+	t.ports = ports
+	t.report.Scope = t.cfg.options.Scope
+	t.report.ShapedService = string(target.GetServiceName())
 
-	if err := runner.RunChecks(context.Background()); err != nil {
-		log.Error("Failed to run checks", "error", err)
-	} else {
-		log.Info("Check results", "results", runner.GetResults())
-		log.Info("Check analysis", "analysis", runner.GetAnalysis())
-		// log.Info("Check logs", "logs", runner.GetLog().GetBuffer().String())
+	peers, err := ResolvePeerPolicies(t.cfg.enclaveContext, target, t.cfg.options.Peers)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve peer policies")
 	}
+	t.peers = peers
+	t.report.Peers = peers
 
-	// Get the service for the node whose bandwidth we want to limit.
-	service, err := GetServiceUnderTest(t.cfg.enclaveContext)
+	groups, err := ResolveGroups(t.cfg.enclaveContext, service, t.cfg.options)
 	if err != nil {
-		return errors.Wrap(err, "failed to get service under test")
+		return errors.Wrap(err, "failed to resolve service groups")
+	}
+	t.report.Groups = summarizeGroups(groups)
+	if len(groups) > 0 {
+		seed := t.cfg.options.Seed
+		t.report.Seed = &seed
 	}
 
-	// Install the tc command.
-	if err := InstallTcCommand(service); err != nil {
-		return errors.Wrap(err, "failed to install tc command")
+	// The checks listen to the service in the background until the test stops.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runner, err := newCheckRunner(ctx, t.cfg.enclaveContext, service, t.cfg.options, groupedServices(groups))
+	if err != nil {
+		return err
 	}
 
-	// Remove any existing bandwidth controls.
-	if err := RemoveBandwidthControls(service); err != nil {
-		log.Info("No existing bandwidth controls seem to be set, continuing...", "message", err)
+	chainClock, err := GetChainClock(ctx, t.cfg.options.clock(), service)
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain clock")
 	}
 
-	// Set the download bandwidth to a reasonable fixed value.
-	if err := SetDownloadBandwidthControl(service, 100_000_000); err != nil {
-		return errors.Wrap(err, "failed to set download bandwidth control")
+	schedule, err := newStepSchedule(chainClock, t.cfg.options.Fork, t.cfg.options.EpochsPerStep)
+	if err != nil {
+		return errors.Wrap(err, "failed to create step schedule")
+	}
+
+	return t.runSteps(ctx, service, target, groups, runner, chainClock, schedule, doneChannel)
+}
+
+// runSteps applies the starting bandwidth and lowers it step by step until the search completes.
+func (t *MinBandwidthTest) runSteps(ctx context.Context, service *services.ServiceContext, target *services.ServiceContext, groups []ServiceGroup, runner checks.Runner, chainClock *ChainClock, schedule *stepSchedule, doneChannel chan struct{}) error {
+	shaper := t.cfg.options.shaper()
+	evaluator := NewCheckEvaluator(service, t.cfg.options.CriticalChecks)
+	if verdict, err := evaluator.Evaluate(ctx, runner); err != nil {
+		log.Error("Failed to run checks", "error", err)
+	} else if !verdict.Passed {
+		log.Warn("Checks are failing before any bandwidth limit is applied", "failed_checks", verdict.FailedChecks)
 	}
 
 	// Set the upload bandwith to a starting point for the tests.
-	if err := SetUploadBandwidthControl(service, t.currentBandwidth); err != nil {
-		return errors.Wrap(err, "failed to set upload bandwidth control")
+	if err := shaper.Apply(target, t.limits(t.currentBandwidth)); err != nil {
+		return errors.Wrap(err, "failed to apply bandwidth limits")
+	}
+	if err := applyGroups(shaper, groups); err != nil {
+		return err
 	}
 
-	// TODO: Don't start the ticker until the genesis time has been reached and the desired fork has
-	// been activated.
-	reductionCount := uint(0)
-	ticker := time.NewTicker(slotDuration)
+	// Start ticking at a slot boundary once the desired fork has been activated.
+	if !schedule.waitForStart(ctx) {
+		return nil
+	}
+	stats := newStatsCollector(shaper, target, chainClock)
+	stats.sample(chainClock.Now())
+	stepCount := uint(0)
+	ticker := chainClock.NewTicker(chainClock.SlotDuration())
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		elapsedEpochs := t.getElapsedEpochs()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		now := chainClock.Now()
+		state := stats.sample(now)
 
-		// Reduce bandwidth every two epochs
-		if reductionCount < elapsedEpochs/2 {
+		// Change bandwidth at the end of each step
+		if schedule.stepDue(stepCount, now) {
 			// Run the checks.
-			if err := runner.RunChecks(context.Background()); err != nil {
-				log.Error("Failed to run checks", "error", err)
-			} else {
-				log.Info("Check results", "results", runner.GetResults())
-				log.Info("Check analysis", "analysis", runner.GetAnalysis())
-				// log.Info("Check logs", "logs", runner.GetLog().GetBuffer().String())
+			verdict, ok := evaluator.EvaluateStep(ctx, runner)
+			if !ok {
+				continue
 			}
 
-			reduction := t.currentBandwidth * t.cfg.delta / 100
-			if t.currentBandwidth-reduction < t.cfg.minBandwidth {
-				log.Info("Bandwidth dropped below minimum threshold, stopping test", "final_bandwidth", FormatBandwidth(t.currentBandwidth), "min_bandwidth", FormatBandwidth(t.cfg.minBandwidth))
+			t.report.AddStep(StepResult{
+				Epoch:         chainClock.EpochAt(now),
+				Timestamp:     now,
+				Bandwidth:     t.currentBandwidth,
+				BlobsPerBlock: t.cfg.blobsPerBlock,
+				Verdict:       verdict,
+				Groups:        evaluateGroups(evaluator, runner, groups),
+				Tc:            state,
+				Stats:         stats.finish(),
+			})
+
+			nextBandwidth, done := t.search.next(t.currentBandwidth, verdict.Passed)
+			if done {
+				t.report.Result = uint(t.search.lastPassing)
+				if verdict.Passed && t.search.firstFailing == 0 {
+					log.Info("Bandwidth dropped below minimum threshold, stopping test", "final_bandwidth", t.currentBandwidth.String(), "min_bandwidth", t.cfg.minBandwidth.String())
+				} else {
+					log.Info("Search complete, stopping test", "strategy", t.cfg.strategy, "last_passing_bandwidth", t.search.lastPassing.String(), "first_failing_bandwidth", t.search.firstFailing.String())
+				}
 				doneChannel <- struct{}{}
 				return nil
 			}
 
-			t.currentBandwidth -= reduction
-
-			if err := UpdateUploadBandwidthControl(service, t.currentBandwidth); err != nil {
-				log.Error("Failed to update bandwidth", "error", err, "epoch", elapsedEpochs, "bandwidth", t.currentBandwidth)
-				continue
+			// The step has already been recorded and the search has moved on, so retrying on the next
+			// slot would record the step again and feed the search a stale bandwidth.
+			if err := shaper.Update(target, t.limits(nextBandwidth)); err != nil {
+				return errors.Wrapf(err, "failed to update bandwidth to %s", nextBandwidth)
 			}
+			t.currentBandwidth = nextBandwidth
+			stepCount++
+
+			// Measure the next step from the moment its limits took effect.
+			stats.sample(chainClock.Now())
 
-			nextReduction := t.startTime.Add(slotDuration * time.Duration((elapsedEpochs+2)*slotsPerEpoch))
-			log.Info("Reduced bandwidth", "epochs", elapsedEpochs, "new_bandwidth", FormatBandwidth(t.currentBandwidth), "next_reduction_at", nextReduction.Local().Format("15:04:05"))
-			reductionCount++
+			log.Info("Updated bandwidth", "epoch", chainClock.EpochAt(now), "new_bandwidth", t.currentBandwidth.String(), "next_step_at", schedule.stepEnd(stepCount).Local().Format("15:04:05"))
 		}
 	}
 }
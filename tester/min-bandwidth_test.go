@@ -0,0 +1,268 @@
+package tester
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethpandaops/panda-pulse/pkg/analyzer"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/ethpandaops/panda-pulse/pkg/logger"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+// fakeCheckRunner is a checks.Runner whose single check passes when passes returns true, or that
+// fails to run the checks if err is set.
+type fakeCheckRunner struct {
+	passes  func() bool
+	err     error
+	results []*checks.Result
+}
+
+func (r *fakeCheckRunner) RegisterCheck(check checks.Check) {}
+
+func (r *fakeCheckRunner) RunChecks(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+	status := checks.StatusOK
+	if !r.passes() {
+		status = checks.StatusFail
+	}
+	r.results = []*checks.Result{{Name: "Fake check", Status: status, Timestamp: time.Now()}}
+	return nil
+}
+
+func (r *fakeCheckRunner) GetResults() []*checks.Result {
+	return r.results
+}
+
+func (r *fakeCheckRunner) GetAnalysis() *analyzer.AnalysisResult {
+	return nil
+}
+
+func (r *fakeCheckRunner) GetLog() *logger.CheckLogger {
+	return nil
+}
+
+func newTestService() *services.ServiceContext {
+	return services.NewServiceContext(nil, "cl-1-prysm-geth", "uuid", "10.0.0.1", nil, "", nil)
+}
+
+// runMinBandwidthTest runs a min-bandwidth test from 50mbit whose checks pass at or above
+// passingBandwidth, advancing a fake clock a slot at a time, each time the test is waiting for it,
+// until the search completes.
+func runMinBandwidthTest(t *testing.T, strategy SearchStrategy, passingBandwidth Bandwidth) (*MinBandwidthTest, *RecordingShaper) {
+	t.Helper()
+
+	chainClock, clock := newTestChainClock(10, map[string]uint64{"fulu": 0})
+	schedule, err := newStepSchedule(chainClock, "fulu", 2)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+
+	shaper := NewRecordingShaper("eth0")
+	test := NewMinBandwidthTest(nil, 6, 50_000_000, 1_000_000, 50, strategy, 1_000_000, TestOptions{Shaper: shaper})
+	runner := &fakeCheckRunner{passes: func() bool { return test.currentBandwidth >= passingBandwidth }}
+	service := newTestService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneChannel := make(chan struct{}, 1)
+	errChannel := make(chan error, 1)
+	go func() {
+		errChannel <- test.runSteps(context.Background(), service, service, nil, runner, chainClock, schedule, doneChannel)
+		cancel()
+	}()
+
+	for slots := 0; clock.BlockUntil(ctx, 1) == nil; slots++ {
+		if slots > 10_000 {
+			t.Fatal("search didn't complete")
+		}
+		clock.Advance(chainClock.SlotDuration())
+	}
+
+	if err := <-errChannel; err != nil {
+		t.Fatalf("runSteps() error = %v", err)
+	}
+	select {
+	case <-doneChannel:
+	default:
+		t.Fatal("runSteps() returned without completing the search")
+	}
+	return test, shaper
+}
+
+func TestStepScheduleWithFakeClock(t *testing.T) {
+	chainClock, clock := newTestChainClock(10, map[string]uint64{"fulu": 0})
+	schedule, err := newStepSchedule(chainClock, "fulu", 2)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		schedule.waitForStart(context.Background())
+		close(started)
+	}()
+
+	for chainClock.CurrentEpoch() < 11 {
+		if err := clock.BlockUntil(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-started:
+			t.Fatalf("waitForStart returned at epoch %d, before the schedule's first epoch", chainClock.CurrentEpoch())
+		default:
+		}
+		clock.Advance(chainClock.SlotDuration())
+	}
+	<-started
+
+	if schedule.stepDue(0, chainClock.EpochStart(12)) {
+		t.Error("step 0 is due after one epoch of two")
+	}
+	if !schedule.stepDue(0, chainClock.EpochStart(13)) {
+		t.Error("step 0 isn't due after two epochs")
+	}
+	if schedule.stepDue(1, chainClock.EpochStart(14)) {
+		t.Error("step 1 is due after one epoch of two")
+	}
+	if got, want := schedule.stepEnd(1), chainClock.EpochStart(15); !got.Equal(want) {
+		t.Errorf("stepEnd(1) = %s, want %s", got, want)
+	}
+}
+
+func TestMinBandwidthStopsWhenCancelled(t *testing.T) {
+	chainClock, clock := newTestChainClock(10, map[string]uint64{"fulu": 0})
+	schedule, err := newStepSchedule(chainClock, "fulu", 2)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+
+	shaper := NewRecordingShaper("eth0")
+	test := NewMinBandwidthTest(nil, 6, 50_000_000, 1_000_000, 50, SearchGeometric, 1_000_000, TestOptions{Shaper: shaper})
+	runner := &fakeCheckRunner{passes: func() bool { return true }}
+	service := newTestService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	doneChannel := make(chan struct{}, 1)
+	errChannel := make(chan error, 1)
+	go func() {
+		errChannel <- test.runSteps(ctx, service, service, nil, runner, chainClock, schedule, doneChannel)
+	}()
+
+	// Run until the first step has been recorded and the test is waiting for the next slot.
+	for len(test.Report().Steps) == 0 {
+		if err := clock.BlockUntil(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(chainClock.SlotDuration())
+	}
+	if err := clock.BlockUntil(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	calls := len(shaper.Calls())
+
+	cancel()
+	select {
+	case err := <-errChannel:
+		if err != nil {
+			t.Fatalf("runSteps() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runSteps() didn't return after ctx was cancelled")
+	}
+	select {
+	case <-doneChannel:
+		t.Error("runSteps() completed the search after ctx was cancelled")
+	default:
+	}
+	if len(test.Report().Steps) != 1 || len(shaper.Calls()) != calls {
+		t.Errorf("runSteps() kept running after ctx was cancelled: %d steps, %d shaper calls, want 1 and %d", len(test.Report().Steps), len(shaper.Calls()), calls)
+	}
+}
+
+func TestMinBandwidthGeometricSearch(t *testing.T) {
+	test, _ := runMinBandwidthTest(t, SearchGeometric, 10_000_000)
+
+	lastPassing, firstFailing := test.Bounds()
+	if lastPassing != 12_500_000 || firstFailing != 6_250_000 {
+		t.Errorf("Bounds() = %s, %s, want 12.5mbit, 6.25mbit", lastPassing, firstFailing)
+	}
+	if test.Report().Result != 12_500_000 {
+		t.Errorf("Result = %d, want 12500000", test.Report().Result)
+	}
+
+	steps := test.Report().Steps
+	wantBandwidths := []Bandwidth{50_000_000, 25_000_000, 12_500_000, 6_250_000}
+	if len(steps) != len(wantBandwidths) {
+		t.Fatalf("got %d steps, want %d", len(steps), len(wantBandwidths))
+	}
+	for i, step := range steps {
+		if step.Bandwidth != wantBandwidths[i] {
+			t.Errorf("step %d bandwidth = %s, want %s", i, step.Bandwidth, wantBandwidths[i])
+		}
+		// The schedule starts at epoch 11 and each step lasts two epochs.
+		if wantEpoch := uint64(11 + 2*(i+1)); step.Epoch != wantEpoch {
+			t.Errorf("step %d ended at epoch %d, want %d", i, step.Epoch, wantEpoch)
+		}
+		if step.Verdict.Passed != (step.Bandwidth >= 10_000_000) {
+			t.Errorf("step %d passed = %t at %s", i, step.Verdict.Passed, step.Bandwidth)
+		}
+	}
+}
+
+// shapedBandwidths returns the upload bandwidths the test applied, in order, checking that the first
+// was applied and the rest were updates.
+func shapedBandwidths(t *testing.T, shaper *RecordingShaper) []Bandwidth {
+	t.Helper()
+
+	var bandwidths []Bandwidth
+	for _, call := range shaper.Calls() {
+		switch call.Method {
+		case "Apply":
+			if len(bandwidths) > 0 {
+				t.Errorf("limits applied again after %d steps", len(bandwidths))
+			}
+		case "Update":
+			if len(bandwidths) == 0 {
+				t.Error("limits updated before they were applied")
+			}
+		default:
+			continue
+		}
+		if call.Target != "cl-1-prysm-geth" {
+			t.Errorf("%s called on %s", call.Method, call.Target)
+		}
+		bandwidths = append(bandwidths, call.Limits.UploadBandwidth)
+	}
+	return bandwidths
+}
+
+func TestMinBandwidthShaperUpdates(t *testing.T) {
+	tests := []struct {
+		strategy SearchStrategy
+		want     []Bandwidth
+	}{
+		{
+			strategy: SearchGeometric,
+			want:     []Bandwidth{50_000_000, 25_000_000, 12_500_000, 6_250_000},
+		},
+		{
+			// After the first failure, bisect until the bounds are within the 1mbit precision.
+			strategy: SearchBisect,
+			want:     []Bandwidth{50_000_000, 25_000_000, 12_500_000, 6_250_000, 9_375_000, 10_937_500, 10_156_250},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			_, shaper := runMinBandwidthTest(t, tt.strategy, 10_000_000)
+
+			if got := shapedBandwidths(t, shaper); !slices.Equal(got, tt.want) {
+				t.Errorf("applied bandwidths %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+type ipAddrJSON struct {
+	Ifname   string `json:"ifname"`
+	AddrInfo []struct {
+		Local string `json:"local"`
+	} `json:"addr_info"`
+}
+
+// detectInterface finds the interface that carries the service's private IP address, which is the
+// one its peers in the enclave reach it through.
+func detectInterface(service *services.ServiceContext) (string, error) {
+	output, err := execCommand(service, "ip -j addr show", "list network interfaces")
+	if err != nil {
+		return "", err
+	}
+
+	var links []ipAddrJSON
+	if err := json.Unmarshal([]byte(output), &links); err != nil {
+		return "", errors.Wrap(err, "failed to parse network interfaces")
+	}
+
+	ip := service.GetPrivateIPAddress()
+	for _, link := range links {
+		for _, addr := range link.AddrInfo {
+			if addr.Local == ip {
+				return link.Ifname, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no interface in %s has its private IP address %s", service.GetServiceName(), ip)
+}
@@ -0,0 +1,73 @@
+package tester
+
+import "time"
+
+// TestOptions holds the settings that every test shares.
+type TestOptions struct {
+	// CriticalChecks are the names of the checks that fail a step. If empty, every check is critical.
+	CriticalChecks []string
+	// ChecksFile is a YAML file of PromQL checks to add to, or replace, the default ones.
+	ChecksFile string
+	// GossipPercentile and GossipDeadline set how late blocks and sidecars may arrive at the service
+	// under test. If zero, the 95th percentile and the attestation deadline are used.
+	GossipPercentile float64
+	GossipDeadline   time.Duration
+	// MinPeerRatio and MinMeshRatio are the fractions of the service under test's connected peers
+	// and mesh peers from before the test that must remain, and MaxScoreDrop is how far the average
+	// score it gives its peers may fall. If zero, the defaults of the peer degradation check are used.
+	MinPeerRatio float64
+	MinMeshRatio float64
+	MaxScoreDrop float64
+	// Reference is the consensus client whose view of the chain proposals are judged by. If empty,
+	// the first one outside the service under test's participant and the shaped services is used.
+	Reference string
+	// Validators are the indices of the service under test's validators. If empty, they're read from
+	// the enclave's validator ranges.
+	Validators []uint64
+	// Fork is the fork that must be active before the first step starts, e.g. "fulu". If empty, the
+	// first step starts at the next epoch.
+	Fork string
+	// EpochsPerStep is the number of epochs each bandwidth or blob count is held for.
+	EpochsPerStep uint
+	// Clock drives the step schedule. If nil, the real clock is used.
+	Clock Clock
+	// Netem emulates latency and unreliability on top of the upload bandwidth limit.
+	Netem NetemParams
+	// DownloadLimiter selects how the download bandwidth is enforced.
+	DownloadLimiter DownloadLimiter
+	// DownloadNetem emulates latency and unreliability on top of the download bandwidth limit.
+	DownloadNetem NetemParams
+	// Scope selects which traffic is shaped, and so which service.
+	Scope ShapingScope
+	// Service is the name of the service under test. If empty, DefaultServiceUnderTest is used.
+	Service string
+	// Groups shape other services throughout the test, each with their own limits.
+	Groups []GroupPolicy
+	// Seed makes the groups' random picks and sampled bandwidths reproducible.
+	Seed uint64
+	// Peers limit the traffic sent to particular services separately from the rest.
+	Peers []PeerPolicy
+	// Shaper applies the bandwidth limits. If nil, limits are applied with tc in the target service.
+	Shaper Shaper
+}
+
+func (o TestOptions) clock() Clock {
+	if o.Clock == nil {
+		return RealClock
+	}
+	return o.Clock
+}
+
+func (o TestOptions) service() string {
+	if o.Service == "" {
+		return DefaultServiceUnderTest
+	}
+	return o.Service
+}
+
+func (o TestOptions) shaper() Shaper {
+	if o.Shaper == nil {
+		return NewTcShaper("")
+	}
+	return o.Shaper
+}
@@ -0,0 +1,361 @@
+package tester
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// partitionChain holds the rules that drop a partitioned service's traffic, so that healing only
+// has to remove the chain.
+const partitionChain = "BLOB-BENCHMARKS"
+
+// PartitionService drops all traffic between the service and the IPs until HealService is called,
+// replacing any partition already in place. If the partition can't be completed, whatever part of it
+// was created is removed.
+func PartitionService(service *services.ServiceContext, ips []string) error {
+	if err := installTool(service, iptablesTool); err != nil {
+		return errors.Wrap(err, "failed to install iptables")
+	}
+
+	if err := HealService(service); err != nil {
+		log.Debug("No existing partition to heal", "service", service.GetServiceName(), "message", err)
+	}
+
+	log.Info("Partitioning service", "service", service.GetServiceName(), "peers", len(ips))
+	commands := []string{
+		fmt.Sprintf("iptables -N %s", partitionChain),
+		fmt.Sprintf("iptables -I INPUT 1 -j %s", partitionChain),
+		fmt.Sprintf("iptables -I OUTPUT 1 -j %s", partitionChain),
+	}
+	for _, ip := range ips {
+		commands = append(commands,
+			fmt.Sprintf("iptables -A %s -s %s -j DROP", partitionChain, ip),
+			fmt.Sprintf("iptables -A %s -d %s -j DROP", partitionChain, ip),
+		)
+	}
+
+	for _, command := range commands {
+		if _, err := execCommand(service, command, "partition service"); err != nil {
+			if healErr := HealService(service); healErr != nil {
+				log.Error("Failed to heal partial partition", "service", service.GetServiceName(), "error", healErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// missingRuleMessages are how iptables reports that a rule or chain to delete doesn't exist.
+var missingRuleMessages = []string{
+	"does a matching rule exist",
+	"No chain/target/match by that name",
+	"Couldn't load target",
+}
+
+// HealService removes the partition created by PartitionService, or whatever part of it exists.
+// Every command is run even if an earlier one fails, and the hooks that don't exist aren't errors.
+func HealService(service *services.ServiceContext) error {
+	hooks := []string{
+		fmt.Sprintf("iptables -D INPUT -j %s", partitionChain),
+		fmt.Sprintf("iptables -D OUTPUT -j %s", partitionChain),
+	}
+	chain := []string{
+		fmt.Sprintf("iptables -F %s", partitionChain),
+		fmt.Sprintf("iptables -X %s", partitionChain),
+	}
+
+	var errs []error
+	for _, command := range hooks {
+		logs, err := execCommand(service, command, "heal partition")
+		if err != nil && !isMissingRule(logs) {
+			errs = append(errs, err)
+		}
+	}
+	for _, command := range chain {
+		if _, err := execCommand(service, command, "heal partition"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+func isMissingRule(logs string) bool {
+	for _, message := range missingRuleMessages {
+		if strings.Contains(logs, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchServices returns the services whose names match any of the patterns, sorted by name.
+func matchServices(enclaveContext *enclaves.EnclaveContext, patterns []string) ([]*services.ServiceContext, error) {
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	var names []string
+	for name := range serviceNames {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, string(name)); ok {
+				names = append(names, string(name))
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var matched []*services.ServiceContext
+	for _, name := range names {
+		service, err := enclaveContext.GetServiceContext(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get service context for %s", name)
+		}
+		matched = append(matched, service)
+	}
+	return matched, nil
+}
+
+type PartitionTestConfig struct {
+	enclaveContext  *enclaves.EnclaveContext
+	isolate         []string
+	from            []string
+	partitionEpochs uint
+	recoveryEpochs  uint
+	options         TestOptions
+}
+
+type PartitionTest struct {
+	cfg    PartitionTestConfig
+	report Report
+
+	// mu guards partitioned, which Heal may read from another goroutine while the test runs.
+	mu          sync.Mutex
+	partitioned []*services.ServiceContext
+}
+
+// NewPartitionTest returns a test that cuts the services matching the isolate patterns off from
+// those matching the from patterns for partitionEpochs, then measures how many epochs the service
+// under test takes to pass its checks again, giving up after recoveryEpochs. If isolate is empty,
+// only the service under test is isolated.
+func NewPartitionTest(enclaveContext *enclaves.EnclaveContext, isolate []string, from []string, partitionEpochs uint, recoveryEpochs uint, options TestOptions) *PartitionTest {
+	return &PartitionTest{
+		cfg: PartitionTestConfig{
+			enclaveContext:  enclaveContext,
+			isolate:         isolate,
+			from:            from,
+			partitionEpochs: partitionEpochs,
+			recoveryEpochs:  recoveryEpochs,
+			options:         options,
+		},
+		report: Report{Test: "partition"},
+	}
+}
+
+func (t *PartitionTest) Report() *Report {
+	return &t.report
+}
+
+// RecoveryEpochs returns the number of epochs after healing before the checks passed, or zero if
+// they didn't pass in time.
+func (t *PartitionTest) RecoveryEpochs() uint {
+	return t.report.Result
+}
+
+// Heal removes the partition from every service the test isolated. It is safe to call at any time
+// and more than once.
+func (t *PartitionTest) Heal() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, service := range t.partitioned {
+		if err := HealService(service); err != nil {
+			log.Error("Failed to heal partition", "service", service.GetServiceName(), "error", err)
+		}
+	}
+	t.partitioned = nil
+}
+
+func (t *PartitionTest) groups(service *services.ServiceContext) ([]*services.ServiceContext, []string, error) {
+	isolated := []*services.ServiceContext{service}
+	if len(t.cfg.isolate) > 0 {
+		var err error
+		isolated, err = matchServices(t.cfg.enclaveContext, t.cfg.isolate)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(isolated) == 0 {
+		return nil, nil, fmt.Errorf("no services match %v", t.cfg.isolate)
+	}
+
+	others, err := matchServices(t.cfg.enclaveContext, t.cfg.from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ips := partitionIPs(isolated, others)
+	if len(ips) == 0 {
+		return nil, nil, fmt.Errorf("no services to partition from match %v", t.cfg.from)
+	}
+
+	return isolated, ips, nil
+}
+
+// partitionIPs returns the IPs of the other services that the isolated services are cut off from,
+// leaving out the isolated services themselves so that they can still reach each other.
+func partitionIPs(isolated []*services.ServiceContext, others []*services.ServiceContext) []string {
+	isIsolated := make(map[services.ServiceName]bool)
+	for _, s := range isolated {
+		isIsolated[s.GetServiceName()] = true
+	}
+
+	var ips []string
+	for _, s := range others {
+		if !isIsolated[s.GetServiceName()] {
+			ips = append(ips, s.GetPrivateIPAddress())
+		}
+	}
+	return ips
+}
+
+// partition isolates each service from the IPs, recording it so that Heal removes its partition.
+func (t *PartitionTest) partition(isolated []*services.ServiceContext, ips []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range isolated {
+		if err := PartitionService(s, ips); err != nil {
+			return errors.Wrapf(err, "failed to partition %s", s.GetServiceName())
+		}
+		t.partitioned = append(t.partitioned, s)
+	}
+	return nil
+}
+
+func (t *PartitionTest) Run(ctx context.Context, doneChannel chan struct{}) error {
+	if t.cfg.partitionEpochs == 0 {
+		return fmt.Errorf("the partition must last at least one epoch")
+	}
+
+	service, err := GetServiceUnderTest(t.cfg.enclaveContext, t.cfg.options.service())
+	if err != nil {
+		return errors.Wrap(err, "failed to get service under test")
+	}
+	t.report.Service = string(service.GetServiceName())
+
+	isolated, ips, err := t.groups(service)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve partition")
+	}
+
+	// The checks listen to the service in the background until the test stops.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runner, err := newCheckRunner(ctx, t.cfg.enclaveContext, service, t.cfg.options, isolated)
+	if err != nil {
+		return err
+	}
+
+	chainClock, err := GetChainClock(ctx, t.cfg.options.clock(), service)
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain clock")
+	}
+
+	// Checks are run every epoch so that recovery is measured precisely.
+	schedule, err := newStepSchedule(chainClock, t.cfg.options.Fork, 1)
+	if err != nil {
+		return errors.Wrap(err, "failed to create step schedule")
+	}
+
+	return t.runSteps(ctx, service, isolated, ips, runner, chainClock, schedule, doneChannel)
+}
+
+// runSteps partitions the isolated services, heals them after the partition's epochs, and checks
+// every epoch until the service under test recovers or runs out of recovery epochs.
+func (t *PartitionTest) runSteps(ctx context.Context, service *services.ServiceContext, isolated []*services.ServiceContext, ips []string, runner checks.Runner, chainClock *ChainClock, schedule *stepSchedule, doneChannel chan struct{}) error {
+	evaluator := NewCheckEvaluator(service, t.cfg.options.CriticalChecks)
+	if verdict, err := evaluator.Evaluate(ctx, runner); err != nil {
+		log.Error("Failed to run checks", "error", err)
+	} else if !verdict.Passed {
+		log.Warn("Checks are failing before the partition", "failed_checks", verdict.FailedChecks)
+	}
+
+	// Start ticking at a slot boundary once the desired fork has been activated.
+	if !schedule.waitForStart(ctx) {
+		return nil
+	}
+	// Whatever stops the test, the services it isolated shouldn't stay partitioned.
+	defer t.Heal()
+	if err := t.partition(isolated, ips); err != nil {
+		return err
+	}
+	log.Info("Partition started", "isolated", len(isolated), "peers", len(ips), "heal_at", schedule.stepEnd(t.cfg.partitionEpochs-1).Local().Format("15:04:05"))
+
+	stepCount := uint(0)
+	ticker := chainClock.NewTicker(chainClock.SlotDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		now := chainClock.Now()
+
+		if !schedule.stepDue(stepCount, now) {
+			continue
+		}
+
+		verdict, ok := evaluator.EvaluateStep(ctx, runner)
+		if !ok {
+			continue
+		}
+
+		phase := "partitioned"
+		if stepCount >= t.cfg.partitionEpochs {
+			phase = "healed"
+		}
+		t.report.AddStep(StepResult{
+			Epoch:     chainClock.EpochAt(now),
+			Timestamp: now,
+			Phase:     phase,
+			Verdict:   verdict,
+		})
+		stepCount++
+
+		if stepCount == t.cfg.partitionEpochs {
+			t.Heal()
+			log.Info("Partition healed", "epoch", chainClock.EpochAt(now))
+			continue
+		}
+
+		if stepCount > t.cfg.partitionEpochs {
+			epochsSinceHeal := stepCount - t.cfg.partitionEpochs
+			if verdict.Passed {
+				t.report.Result = epochsSinceHeal
+				log.Info("Checks passed after healing, stopping test", "recovery_epochs", epochsSinceHeal)
+				doneChannel <- struct{}{}
+				return nil
+			}
+			if epochsSinceHeal >= t.cfg.recoveryEpochs {
+				log.Info("Checks didn't recover in time, stopping test", "recovery_epochs", t.cfg.recoveryEpochs, "failed_checks", verdict.FailedChecks)
+				doneChannel <- struct{}{}
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package tester
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+// iptablesRunner records the commands run in a service and keeps just enough iptables state to
+// answer them the way iptables does. The command equal to failOn fails.
+type iptablesRunner struct {
+	commands []string
+	failOn   string
+
+	chain bool
+	rules []string
+	hooks map[string]bool
+}
+
+func newIptablesRunner() *iptablesRunner {
+	return &iptablesRunner{hooks: make(map[string]bool)}
+}
+
+func (r *iptablesRunner) exec(command []string) (int32, string) {
+	joined := strings.Join(command, " ")
+	r.commands = append(r.commands, joined)
+	if joined == r.failOn {
+		return 1, "iptables: Resource temporarily unavailable."
+	}
+	if len(command) < 3 {
+		return 0, "iptables v1.8.9 (nf_tables)"
+	}
+
+	switch command[1] {
+	case "-N":
+		if r.chain {
+			return 1, "iptables: Chain already exists."
+		}
+		r.chain = true
+	case "-I":
+		if !r.chain {
+			return 1, "iptables v1.8.9 (nf_tables): Couldn't load target `BLOB-BENCHMARKS'"
+		}
+		r.hooks[command[2]] = true
+	case "-D":
+		if !r.hooks[command[2]] {
+			return 1, "iptables: Bad rule (does a matching rule exist in that chain?)."
+		}
+		delete(r.hooks, command[2])
+	case "-A":
+		r.rules = append(r.rules, joined)
+	case "-F":
+		if !r.chain {
+			return 1, "iptables: No chain/target/match by that name."
+		}
+		r.rules = nil
+	case "-X":
+		if !r.chain {
+			return 1, "iptables: No chain/target/match by that name."
+		}
+		if len(r.hooks) > 0 || len(r.rules) > 0 {
+			return 1, "iptables: Directory not empty."
+		}
+		r.chain = false
+	}
+	return 0, ""
+}
+
+// clean reports whether nothing of a partition is left.
+func (r *iptablesRunner) clean() bool {
+	return !r.chain && len(r.hooks) == 0 && len(r.rules) == 0
+}
+
+func TestPartitionServiceCommands(t *testing.T) {
+	runner := newIptablesRunner()
+	if err := PartitionService(newExecService(runner.exec), []string{"10.0.0.2", "10.0.0.3"}); err != nil {
+		t.Fatalf("PartitionService() error = %v", err)
+	}
+
+	want := []string{
+		"iptables -V",
+		"iptables -D INPUT -j BLOB-BENCHMARKS",
+		"iptables -D OUTPUT -j BLOB-BENCHMARKS",
+		"iptables -F BLOB-BENCHMARKS",
+		"iptables -X BLOB-BENCHMARKS",
+		"iptables -N BLOB-BENCHMARKS",
+		"iptables -I INPUT 1 -j BLOB-BENCHMARKS",
+		"iptables -I OUTPUT 1 -j BLOB-BENCHMARKS",
+		"iptables -A BLOB-BENCHMARKS -s 10.0.0.2 -j DROP",
+		"iptables -A BLOB-BENCHMARKS -d 10.0.0.2 -j DROP",
+		"iptables -A BLOB-BENCHMARKS -s 10.0.0.3 -j DROP",
+		"iptables -A BLOB-BENCHMARKS -d 10.0.0.3 -j DROP",
+	}
+	if !slices.Equal(runner.commands, want) {
+		t.Errorf("commands = %q, want %q", runner.commands, want)
+	}
+
+	if err := HealService(newExecService(runner.exec)); err != nil {
+		t.Fatalf("HealService() error = %v", err)
+	}
+	if !runner.clean() {
+		t.Errorf("partition left after healing: chain %v, hooks %v, rules %q", runner.chain, runner.hooks, runner.rules)
+	}
+}
+
+func TestPartitionServiceRemovesPartialPartition(t *testing.T) {
+	tests := []struct {
+		name   string
+		failOn string
+	}{
+		{name: "input hook", failOn: "iptables -I INPUT 1 -j BLOB-BENCHMARKS"},
+		{name: "output hook", failOn: "iptables -I OUTPUT 1 -j BLOB-BENCHMARKS"},
+		{name: "drop rule", failOn: "iptables -A BLOB-BENCHMARKS -d 10.0.0.2 -j DROP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := newIptablesRunner()
+			runner.failOn = tt.failOn
+			if err := PartitionService(newExecService(runner.exec), []string{"10.0.0.2"}); err == nil {
+				t.Fatal("PartitionService() error = nil, want the failed command's error")
+			}
+			if !runner.clean() {
+				t.Fatalf("partition left after failing: chain %v, hooks %v, rules %q", runner.chain, runner.hooks, runner.rules)
+			}
+
+			// Nothing is left behind to stop the next partition.
+			runner.failOn = ""
+			if err := PartitionService(newExecService(runner.exec), []string{"10.0.0.2"}); err != nil {
+				t.Errorf("PartitionService() after a failure error = %v", err)
+			}
+		})
+	}
+}
+
+func TestHealServiceRunsEveryCommand(t *testing.T) {
+	runner := newIptablesRunner()
+	if err := PartitionService(newExecService(runner.exec), []string{"10.0.0.2"}); err != nil {
+		t.Fatalf("PartitionService() error = %v", err)
+	}
+
+	runner.commands = nil
+	runner.failOn = "iptables -D INPUT -j BLOB-BENCHMARKS"
+	err := HealService(newExecService(runner.exec))
+	if err == nil || !strings.Contains(err.Error(), "Resource temporarily unavailable") {
+		t.Errorf("HealService() error = %v, want the failed command's error", err)
+	}
+	if len(runner.commands) != 4 {
+		t.Errorf("commands = %q, want all four heal commands", runner.commands)
+	}
+	if runner.hooks["OUTPUT"] {
+		t.Error("OUTPUT hook left after the INPUT hook failed to be removed")
+	}
+}
+
+func TestPartitionIPsExcludesIsolatedServices(t *testing.T) {
+	service := func(name string, ip string) *services.ServiceContext {
+		return services.NewServiceContext(nil, services.ServiceName(name), "uuid", ip, nil, "", nil)
+	}
+	isolated := []*services.ServiceContext{service("cl-1-prysm-geth", "10.0.0.1"), service("cl-2-prysm-geth", "10.0.0.2")}
+	others := []*services.ServiceContext{
+		service("cl-1-prysm-geth", "10.0.0.1"),
+		service("cl-2-prysm-geth", "10.0.0.2"),
+		service("cl-3-lighthouse-geth", "10.0.0.3"),
+		service("cl-4-teku-geth", "10.0.0.4"),
+	}
+
+	if got, want := partitionIPs(isolated, others), []string{"10.0.0.3", "10.0.0.4"}; !slices.Equal(got, want) {
+		t.Errorf("partitionIPs() = %v, want %v", got, want)
+	}
+}
+
+// runPartitionTest partitions the service under test for two epochs and runs the test to completion
+// with a fake clock, with checks that fail until passesAfter steps have been recorded.
+func runPartitionTest(t *testing.T, passesAfter int, recoveryEpochs uint) (*PartitionTest, *iptablesRunner) {
+	t.Helper()
+
+	chainClock, clock := newTestChainClock(10, map[string]uint64{"fulu": 0})
+	schedule, err := newStepSchedule(chainClock, "fulu", 1)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+
+	iptables := newIptablesRunner()
+	test := NewPartitionTest(nil, nil, nil, 2, recoveryEpochs, TestOptions{})
+	runner := &fakeCheckRunner{passes: func() bool { return len(test.report.Steps) >= passesAfter }}
+	service := newExecService(iptables.exec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneChannel := make(chan struct{}, 1)
+	errChannel := make(chan error, 1)
+	go func() {
+		errChannel <- test.runSteps(context.Background(), service, []*services.ServiceContext{service}, []string{"10.0.0.2"}, runner, chainClock, schedule, doneChannel)
+		cancel()
+	}()
+
+	for slots := 0; clock.BlockUntil(ctx, 1) == nil; slots++ {
+		if slots > 10_000 {
+			t.Fatal("test didn't complete")
+		}
+		clock.Advance(chainClock.SlotDuration())
+	}
+
+	if err := <-errChannel; err != nil {
+		t.Fatalf("runSteps() error = %v", err)
+	}
+	select {
+	case <-doneChannel:
+	default:
+		t.Fatal("runSteps() returned without completing the test")
+	}
+	return test, iptables
+}
+
+func TestPartitionTestRecovery(t *testing.T) {
+	// Two partitioned steps, then checks pass from the second step after healing.
+	test, iptables := runPartitionTest(t, 3, 4)
+
+	if got := test.RecoveryEpochs(); got != 2 {
+		t.Errorf("RecoveryEpochs() = %d, want 2", got)
+	}
+	var phases []string
+	for _, step := range test.report.Steps {
+		phases = append(phases, step.Phase)
+	}
+	if want := []string{"partitioned", "partitioned", "healed", "healed"}; !slices.Equal(phases, want) {
+		t.Errorf("phases = %v, want %v", phases, want)
+	}
+	if !iptables.clean() {
+		t.Error("partition left after the test")
+	}
+}
+
+func TestPartitionTestGivesUpRecovering(t *testing.T) {
+	test, iptables := runPartitionTest(t, 100, 3)
+
+	if got := test.RecoveryEpochs(); got != 0 {
+		t.Errorf("RecoveryEpochs() = %d, want 0", got)
+	}
+	// Two partitioned steps and three healed ones.
+	if got := len(test.report.Steps); got != 5 {
+		t.Errorf("got %d steps, want 5", got)
+	}
+	if !iptables.clean() {
+		t.Error("partition left after the test")
+	}
+}
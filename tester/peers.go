@@ -0,0 +1,138 @@
+package tester
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// maxPeerPolicies keeps the number of prio bands within tc's limit of 16, leaving room for the
+// scoped and default bands.
+const maxPeerPolicies = 14
+
+// PeerPolicy describes the link from the shaped service to a group of other services in the enclave.
+type PeerPolicy struct {
+	// Pattern is matched against service names with path.Match, e.g. "cl-*-lighthouse-*".
+	Pattern string
+	// UploadBandwidth is the rate limit on traffic sent to the group. If zero, the traffic is still
+	// held to the default upload bandwidth.
+	UploadBandwidth Bandwidth
+	// Netem emulates latency and unreliability on traffic sent to the group.
+	Netem NetemParams
+}
+
+// ParsePeerPolicy parses a policy of the form "<pattern>:<key>=<value>:...", where the keys are
+// bandwidth (e.g. "10mbit"), latency, jitter, loss, duplicate and reorder, e.g.
+// "cl-2-*:bandwidth=10mbit:latency=80ms".
+func ParsePeerPolicy(s string) (PeerPolicy, error) {
+	parts := strings.Split(s, ":")
+	policy := PeerPolicy{Pattern: parts[0]}
+	if policy.Pattern == "" {
+		return PeerPolicy{}, fmt.Errorf("peer policy %q has no service pattern", s)
+	}
+	if _, err := path.Match(policy.Pattern, ""); err != nil {
+		return PeerPolicy{}, errors.Wrapf(err, "invalid service pattern %q", policy.Pattern)
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return PeerPolicy{}, fmt.Errorf("expected key=value in peer policy %q, got %q", s, part)
+		}
+
+		var err error
+		switch key {
+		case "bandwidth":
+			policy.UploadBandwidth, err = ParseBandwidth(value)
+		default:
+			var isNetem bool
+			isNetem, err = parseNetemField(&policy.Netem, key, value)
+			if !isNetem {
+				return PeerPolicy{}, fmt.Errorf("unknown key %q in peer policy %q", key, s)
+			}
+		}
+		if err != nil {
+			return PeerPolicy{}, errors.Wrapf(err, "invalid %s in peer policy %q", key, s)
+		}
+	}
+
+	if policy.UploadBandwidth == 0 && policy.Netem.IsZero() {
+		return PeerPolicy{}, fmt.Errorf("peer policy %q doesn't limit anything", s)
+	}
+	if err := policy.Netem.Validate(); err != nil {
+		return PeerPolicy{}, errors.Wrapf(err, "invalid network emulation in peer policy %q", s)
+	}
+	return policy, nil
+}
+
+// PeerLimits are the limits on traffic sent to a set of peers, identified by their private IPs.
+type PeerLimits struct {
+	Pattern         string      `json:"pattern"`
+	IPs             []string    `json:"ips"`
+	UploadBandwidth Bandwidth   `json:"upload_bandwidth,omitempty"`
+	Netem           NetemParams `json:"netem,omitempty"`
+}
+
+func peerLimitsEqual(a PeerLimits, b PeerLimits) bool {
+	return a.Pattern == b.Pattern && slices.Equal(a.IPs, b.IPs) && a.UploadBandwidth == b.UploadBandwidth && a.Netem == b.Netem
+}
+
+// ResolvePeerPolicies looks up the private IPs of the services each policy matches, other than the
+// target itself. A service matched by more than one policy is limited by the first.
+func ResolvePeerPolicies(enclaveContext *enclaves.EnclaveContext, target *services.ServiceContext, policies []PeerPolicy) ([]PeerLimits, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	if len(policies) > maxPeerPolicies {
+		return nil, fmt.Errorf("at most %d peer policies are supported, got %d", maxPeerPolicies, len(policies))
+	}
+
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	var names []string
+	for name := range serviceNames {
+		if name != target.GetServiceName() {
+			names = append(names, string(name))
+		}
+	}
+	sort.Strings(names)
+
+	matched := make(map[string]bool)
+	var peers []PeerLimits
+	for _, policy := range policies {
+		limits := PeerLimits{
+			Pattern:         policy.Pattern,
+			UploadBandwidth: policy.UploadBandwidth,
+			Netem:           policy.Netem,
+		}
+
+		for _, name := range names {
+			if ok, _ := path.Match(policy.Pattern, name); !ok || matched[name] {
+				continue
+			}
+			matched[name] = true
+
+			service, err := enclaveContext.GetServiceContext(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get service context for %s", name)
+			}
+			limits.IPs = append(limits.IPs, service.GetPrivateIPAddress())
+		}
+
+		if len(limits.IPs) == 0 {
+			return nil, fmt.Errorf("peer pattern %q doesn't match any services", policy.Pattern)
+		}
+		peers = append(peers, limits)
+	}
+
+	return peers, nil
+}
@@ -0,0 +1,76 @@
+package tester
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StepResult is the outcome of a single step of a test, i.e. one bandwidth or blob count.
+type StepResult struct {
+	Epoch         uint64    `json:"epoch"`
+	Timestamp     time.Time `json:"timestamp"`
+	Bandwidth     Bandwidth `json:"bandwidth"`
+	BlobsPerBlock uint      `json:"blobs_per_block"`
+	// IncludedBlobs is the median number of the spammer's blobs the step's canonical blocks
+	// included, in tests that vary the blob count.
+	IncludedBlobs uint `json:"included_blobs,omitempty"`
+	// Phase is the state of the network during the step in tests that change it, e.g. "partitioned".
+	Phase string `json:"phase,omitempty"`
+	// Limits are every set of limits in effect during the step, in the order they were applied, in
+	// tests that vary more than the bandwidth.
+	Limits  []AppliedLimits `json:"limits,omitempty"`
+	Verdict StepVerdict     `json:"verdict"`
+	// Groups are the verdicts for each group of shaped services, from the same check results.
+	Groups []GroupResult `json:"groups,omitempty"`
+	// Tc is the traffic control state at the end of the step, including the drop and overlimit
+	// counters of each qdisc.
+	Tc *TcState `json:"tc,omitempty"`
+	// Stats are the achieved throughput and drop rate over the step, sampled every slot.
+	Stats *StepStats `json:"stats,omitempty"`
+}
+
+// AppliedLimits are limits and the slot from which they were in effect.
+type AppliedLimits struct {
+	Slot   uint64 `json:"slot"`
+	Limits Limits `json:"limits"`
+}
+
+// Report collects the results of a test run so that it can be written out for analysis.
+type Report struct {
+	Test    string `json:"test"`
+	Service string `json:"service"`
+	// ShapedService is the service whose traffic was shaped, which depends on Scope.
+	ShapedService string       `json:"shaped_service,omitempty"`
+	Scope         ShapingScope `json:"scope,omitempty"`
+	// Peers are the limits on traffic to particular services that applied throughout the test.
+	Peers []PeerLimits `json:"peers,omitempty"`
+	// Groups are the other services shaped throughout the test and their limits.
+	Groups []GroupSummary `json:"groups,omitempty"`
+	// Seed is the random seed the groups were selected and sampled with, if there are any groups.
+	// Running again with the same seed against the same enclave reproduces them.
+	Seed  *uint64      `json:"seed,omitempty"`
+	Steps []StepResult `json:"steps"`
+	// Result is the test's answer: the lowest passing bandwidth, the highest passing blob count, the
+	// number of epochs a partitioned node took to recover or the number of passing steps of a trace.
+	Result uint `json:"result"`
+}
+
+func (r *Report) AddStep(step StepResult) {
+	r.Steps = append(r.Steps, step)
+}
+
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal report")
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
+
+	return nil
+}
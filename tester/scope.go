@@ -0,0 +1,131 @@
+package tester
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// ShapingScope selects which of a node's traffic is shaped.
+type ShapingScope string
+
+const (
+	// ScopeAll shapes all of the service under test's traffic. It is the default.
+	ScopeAll ShapingScope = "all"
+	// ScopeCLP2P shapes only the service under test's consensus layer p2p traffic, leaving the
+	// engine API, beacon API and metrics scraping alone.
+	ScopeCLP2P ShapingScope = "cl-p2p"
+	// ScopeELP2P shapes only the devp2p traffic of the execution client paired with the service
+	// under test, which carries the blob pool.
+	ScopeELP2P ShapingScope = "el-p2p"
+)
+
+func ParseShapingScope(s string) (ShapingScope, error) {
+	switch ShapingScope(s) {
+	case "":
+		return ScopeAll, nil
+	case ScopeAll, ScopeCLP2P, ScopeELP2P:
+		return ShapingScope(s), nil
+	}
+	return "", fmt.Errorf("unknown shaping scope %q, expected %q, %q or %q", s, ScopeAll, ScopeCLP2P, ScopeELP2P)
+}
+
+// isP2PPort reports whether a port exposed by an ethereum-package client carries p2p traffic, e.g.
+// "tcp-discovery", "udp-discovery" or "quic-discovery".
+func isP2PPort(portID string) bool {
+	return strings.Contains(portID, "discovery") || strings.Contains(portID, "p2p")
+}
+
+// p2pPorts returns the p2p ports of every service whose name starts with prefix. Peers' ports are
+// included so that connections the target initiates are matched by their destination port.
+func p2pPorts(enclaveContext *enclaves.EnclaveContext, prefix string) ([]Port, error) {
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	seen := make(map[Port]bool)
+	var ports []Port
+	for name := range serviceNames {
+		if !strings.HasPrefix(string(name), prefix) {
+			continue
+		}
+
+		service, err := enclaveContext.GetServiceContext(string(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get service context for %s", name)
+		}
+
+		for portID, spec := range service.GetPrivatePorts() {
+			if !isP2PPort(portID) {
+				continue
+			}
+
+			port := Port{Number: spec.GetNumber(), Protocol: PortProtocolTCP}
+			if spec.GetTransportProtocol() == services.TransportProtocol_UDP {
+				port.Protocol = PortProtocolUDP
+			}
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no p2p ports found on %s services", strings.TrimSuffix(prefix, "-"))
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Number != ports[j].Number {
+			return ports[i].Number < ports[j].Number
+		}
+		return ports[i].Protocol < ports[j].Protocol
+	})
+	return ports, nil
+}
+
+// pairedExecutionService returns the execution client of the same participant as a consensus
+// client, e.g. el-1-geth-prysm for cl-1-prysm-geth.
+func pairedExecutionService(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext) (*services.ServiceContext, error) {
+	key := participantKey(string(service.GetServiceName()))
+	if key == "" {
+		return nil, fmt.Errorf("can't tell which participant %s belongs to", service.GetServiceName())
+	}
+
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	for name := range serviceNames {
+		if strings.HasPrefix(string(name), "el-") && participantKey(string(name)) == key {
+			return enclaveContext.GetServiceContext(string(name))
+		}
+	}
+
+	return nil, fmt.Errorf("no execution client found for %s", service.GetServiceName())
+}
+
+// ResolveScope returns the service to shape for the service under test and the ports to restrict
+// shaping to, which are empty if all traffic is shaped.
+func ResolveScope(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext, scope ShapingScope) (*services.ServiceContext, []Port, error) {
+	switch scope {
+	case ScopeCLP2P:
+		ports, err := p2pPorts(enclaveContext, "cl-")
+		return service, ports, err
+	case ScopeELP2P:
+		target, err := pairedExecutionService(enclaveContext, service)
+		if err != nil {
+			return nil, nil, err
+		}
+		ports, err := p2pPorts(enclaveContext, "el-")
+		return target, ports, err
+	default:
+		return service, nil, nil
+	}
+}
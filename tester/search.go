@@ -0,0 +1,76 @@
+package tester
+
+import (
+	"fmt"
+)
+
+type SearchStrategy string
+
+const (
+	// SearchGeometric reduces the bandwidth by a fixed percentage until a step fails.
+	SearchGeometric SearchStrategy = "geometric"
+	// SearchBisect reduces the bandwidth geometrically until a step fails, then bisects between the
+	// last passing and first failing bandwidths.
+	SearchBisect SearchStrategy = "bisect"
+)
+
+func ParseSearchStrategy(s string) (SearchStrategy, error) {
+	switch SearchStrategy(s) {
+	case "":
+		return SearchGeometric, nil
+	case SearchGeometric, SearchBisect:
+		return SearchStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown search strategy %q, expected %q or %q", s, SearchGeometric, SearchBisect)
+}
+
+// bandwidthSearch picks the next bandwidth to test from the outcome of the current one. Bandwidths of
+// zero mean that no such step has been seen yet.
+type bandwidthSearch struct {
+	strategy     SearchStrategy
+	delta        uint
+	minBandwidth Bandwidth
+	precision    Bandwidth
+
+	lastPassing  Bandwidth
+	firstFailing Bandwidth
+}
+
+func newBandwidthSearch(strategy SearchStrategy, delta uint, minBandwidth Bandwidth, precision Bandwidth) *bandwidthSearch {
+	return &bandwidthSearch{
+		strategy:     strategy,
+		delta:        delta,
+		minBandwidth: minBandwidth,
+		precision:    precision,
+	}
+}
+
+// next records whether the current bandwidth passed and returns the bandwidth to test next. The
+// second return value is true once the search is complete.
+func (s *bandwidthSearch) next(current Bandwidth, passed bool) (Bandwidth, bool) {
+	if passed {
+		s.lastPassing = current
+	} else {
+		s.firstFailing = current
+	}
+
+	// Keep reducing geometrically until we find a failing bandwidth.
+	if s.firstFailing == 0 {
+		reduction := current * Bandwidth(s.delta) / 100
+		if reduction == 0 || current-reduction < s.minBandwidth {
+			return 0, true
+		}
+		return current - reduction, false
+	}
+
+	if s.strategy != SearchBisect || s.lastPassing == 0 {
+		return 0, true
+	}
+
+	// The midpoint of bounds 1bit apart is the failing bound itself, which has already been tested.
+	midpoint := s.firstFailing + (s.lastPassing-s.firstFailing)/2
+	if s.lastPassing-s.firstFailing <= s.precision || midpoint == s.firstFailing {
+		return 0, true
+	}
+	return midpoint, false
+}
@@ -0,0 +1,35 @@
+package tester
+
+import "testing"
+
+func TestBandwidthSearchBisectEnds(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision Bandwidth
+		maxSteps  int
+	}{
+		{name: "1mbit precision", precision: 1_000_000, maxSteps: 10},
+		{name: "zero precision", precision: 0, maxSteps: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Anything at or above 10,000,001bit passes.
+			search := newBandwidthSearch(SearchBisect, 50, 1, tt.precision)
+			current := Bandwidth(20_000_000)
+			for step := 0; ; step++ {
+				if step > tt.maxSteps {
+					t.Fatalf("search didn't end after %d steps, at %s", tt.maxSteps, current)
+				}
+				next, done := search.next(current, current > 10_000_000)
+				if done {
+					break
+				}
+				current = next
+			}
+
+			if gap := search.lastPassing - search.firstFailing; gap > tt.precision && gap > 1 {
+				t.Errorf("bounds %s and %s are further apart than the precision", search.lastPassing, search.firstFailing)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package tester
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+// Limits describes the network conditions imposed on a target. Zero values leave that aspect of the
+// target's traffic unshaped.
+type Limits struct {
+	// UploadBandwidth is the egress rate limit in bits per second.
+	UploadBandwidth Bandwidth `json:"upload_bandwidth,omitempty"`
+	// DownloadBandwidth is the ingress rate limit in bits per second.
+	DownloadBandwidth Bandwidth `json:"download_bandwidth,omitempty"`
+	// DownloadLimiter selects how the download bandwidth is enforced.
+	DownloadLimiter DownloadLimiter `json:"download_limiter,omitempty"`
+	// Netem emulates latency and unreliability on traffic leaving the target.
+	Netem NetemParams `json:"netem,omitempty"`
+	// DownloadNetem emulates latency and unreliability on traffic arriving at the target. It
+	// requires the IFB download limiter.
+	DownloadNetem NetemParams `json:"download_netem,omitempty"`
+	// Ports restricts shaping to traffic to or from these ports. If empty, all traffic is shaped.
+	Ports []Port `json:"ports,omitempty"`
+	// Peers are limits on traffic sent to particular services, which replace Netem for that traffic
+	// and UploadBandwidth unless they don't set one.
+	Peers []PeerLimits `json:"peers,omitempty"`
+}
+
+type PortProtocol string
+
+const (
+	PortProtocolTCP PortProtocol = "tcp"
+	PortProtocolUDP PortProtocol = "udp"
+)
+
+type Port struct {
+	Number   uint16       `json:"number"`
+	Protocol PortProtocol `json:"protocol"`
+}
+
+type DownloadLimiter string
+
+const (
+	// DownloadLimiterPolice drops ingress packets that exceed the rate. It is the default.
+	DownloadLimiterPolice DownloadLimiter = "police"
+	// DownloadLimiterIFB redirects ingress packets to an IFB device where they are queued and shaped
+	// like egress traffic, which behaves more like a real access link.
+	DownloadLimiterIFB DownloadLimiter = "ifb"
+)
+
+func ParseDownloadLimiter(s string) (DownloadLimiter, error) {
+	switch DownloadLimiter(s) {
+	case "":
+		return DownloadLimiterPolice, nil
+	case DownloadLimiterPolice, DownloadLimiterIFB:
+		return DownloadLimiter(s), nil
+	}
+	return "", fmt.Errorf("unknown download limiter %q, expected %q or %q", s, DownloadLimiterPolice, DownloadLimiterIFB)
+}
+
+// NetemParams are the network impairments emulated by a netem qdisc. Percentages are in the range
+// 0-100.
+type NetemParams struct {
+	Latency   time.Duration `json:"latency,omitempty"`
+	Jitter    time.Duration `json:"jitter,omitempty"`
+	Loss      float64       `json:"loss,omitempty"`
+	Duplicate float64       `json:"duplicate,omitempty"`
+	// Reorder is the percentage of packets sent immediately instead of delayed, so it only has an
+	// effect when Latency is set.
+	Reorder float64 `json:"reorder,omitempty"`
+}
+
+func (n NetemParams) IsZero() bool {
+	return n == NetemParams{}
+}
+
+// parseNetemField sets the parameter named by key from its value, e.g. latency from "100ms" or loss
+// from "1", returning false if key isn't a netem parameter.
+func parseNetemField(params *NetemParams, key string, value string) (bool, error) {
+	var err error
+	switch key {
+	case "latency":
+		params.Latency, err = time.ParseDuration(value)
+	case "jitter":
+		params.Jitter, err = time.ParseDuration(value)
+	case "loss":
+		params.Loss, err = strconv.ParseFloat(value, 64)
+	case "duplicate":
+		params.Duplicate, err = strconv.ParseFloat(value, 64)
+	case "reorder":
+		params.Reorder, err = strconv.ParseFloat(value, 64)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (n NetemParams) Validate() error {
+	if n.Latency < 0 || n.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	if n.Jitter > 0 && n.Latency == 0 {
+		return fmt.Errorf("jitter requires latency")
+	}
+	if n.Reorder > 0 && n.Latency == 0 {
+		return fmt.Errorf("reordering requires latency")
+	}
+	for _, percentage := range []float64{n.Loss, n.Duplicate, n.Reorder} {
+		if percentage < 0 || percentage > 100 {
+			return fmt.Errorf("percentages must be between 0 and 100, got %g", percentage)
+		}
+	}
+	return nil
+}
+
+// Args formats the parameters as arguments to tc's netem qdisc, e.g. "delay 100000us 20000us loss 1%".
+func (n NetemParams) Args() string {
+	var args []string
+	if n.Latency > 0 {
+		args = append(args, fmt.Sprintf("delay %dus", n.Latency.Microseconds()))
+		if n.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", n.Jitter.Microseconds()))
+		}
+	}
+	if n.Loss > 0 {
+		args = append(args, "loss "+formatPercentage(n.Loss))
+	}
+	if n.Duplicate > 0 {
+		args = append(args, "duplicate "+formatPercentage(n.Duplicate))
+	}
+	if n.Reorder > 0 {
+		args = append(args, "reorder "+formatPercentage(n.Reorder))
+	}
+	return strings.Join(args, " ")
+}
+
+func formatPercentage(percentage float64) string {
+	return strconv.FormatFloat(percentage, 'f', -1, 64) + "%"
+}
+
+// Shaper applies network limits to services in the enclave.
+type Shaper interface {
+	// Apply replaces any existing limits on the target with the given limits, preparing the target
+	// for shaping first if necessary.
+	Apply(target *services.ServiceContext, limits Limits) error
+	// Update changes the limits on a target that Apply has already been called for.
+	Update(target *services.ServiceContext, limits Limits) error
+	// Remove removes all limits from the target.
+	Remove(target *services.ServiceContext) error
+	// Inspect reads back the limits currently in effect on the target along with their statistics.
+	Inspect(target *services.ServiceContext) (*TcState, error)
+}
+
+// ShaperCall is a single call made to a RecordingShaper.
+type ShaperCall struct {
+	Method string
+	Target services.ServiceName
+	Limits Limits
+}
+
+// RecordingShaper is a Shaper that records its calls instead of shaping any traffic.
+type RecordingShaper struct {
+	mu     sync.Mutex
+	dev    string
+	calls  []ShaperCall
+	limits map[services.ServiceName]Limits
+}
+
+// NewRecordingShaper returns a shaper whose Inspect reports the limits as a TcShaper would have
+// installed them on the interface dev.
+func NewRecordingShaper(dev string) *RecordingShaper {
+	return &RecordingShaper{
+		dev:    dev,
+		limits: make(map[services.ServiceName]Limits),
+	}
+}
+
+func (s *RecordingShaper) record(method string, target *services.ServiceContext, limits Limits) {
+	s.calls = append(s.calls, ShaperCall{
+		Method: method,
+		Target: target.GetServiceName(),
+		Limits: limits,
+	})
+}
+
+func (s *RecordingShaper) Apply(target *services.ServiceContext, limits Limits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record("Apply", target, limits)
+	s.limits[target.GetServiceName()] = limits
+	return nil
+}
+
+func (s *RecordingShaper) Update(target *services.ServiceContext, limits Limits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record("Update", target, limits)
+	if _, ok := s.limits[target.GetServiceName()]; !ok {
+		return fmt.Errorf("no limits applied to %s", target.GetServiceName())
+	}
+	s.limits[target.GetServiceName()] = limits
+	return nil
+}
+
+func (s *RecordingShaper) Remove(target *services.ServiceContext) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record("Remove", target, Limits{})
+	delete(s.limits, target.GetServiceName())
+	return nil
+}
+
+// Inspect returns the state a TcShaper would have produced for the recorded limits, without any
+// statistics.
+func (s *RecordingShaper) Inspect(target *services.ServiceContext) (*TcState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.record("Inspect", target, Limits{})
+	state := &TcState{Dev: s.dev}
+	limits, ok := s.limits[target.GetServiceName()]
+	if !ok {
+		return state, nil
+	}
+
+	if egressShaped(limits) {
+		classes, rest := egressClasses(limits)
+		if len(classes) == 0 {
+			state.Qdiscs = append(state.Qdiscs, shapingQdiscs(s.dev, "root", 1, rest.bandwidth, rest.netem)...)
+		} else {
+			state.Qdiscs = append(state.Qdiscs, QdiscState{Dev: s.dev, Kind: "prio", Handle: "1:", Root: true})
+			for i, class := range append(classes, rest) {
+				band := i + 1
+				if class.shaped() {
+					state.Qdiscs = append(state.Qdiscs, shapingQdiscs(s.dev, fmt.Sprintf("1:%x", band), uint(0x10+band), class.bandwidth, class.netem)...)
+				}
+			}
+		}
+	}
+	if !ingressShaped(limits) {
+		return state, nil
+	}
+
+	state.Qdiscs = append(state.Qdiscs, QdiscState{Dev: s.dev, Kind: "ingress", Handle: "ffff:"})
+	if limits.DownloadLimiter == DownloadLimiterIFB {
+		state.IngressActions = append(state.IngressActions, FilterAction{Kind: "mirred", RedirectDev: ifbDevice})
+		state.Qdiscs = append(state.Qdiscs, shapingQdiscs(ifbDevice, "root", 1, limits.DownloadBandwidth, limits.DownloadNetem)...)
+	} else {
+		state.IngressActions = append(state.IngressActions, FilterAction{Kind: "police", Rate: limits.DownloadBandwidth})
+	}
+	return state, nil
+}
+
+// shapingQdiscs returns the qdiscs setShapingQdiscs installs on dev under parent, which is either
+// "root" or a class such as "1:1".
+func shapingQdiscs(dev string, parent string, major uint, bandwidth Bandwidth, netem NetemParams) []QdiscState {
+	place := func(qdisc QdiscState, parent string) QdiscState {
+		if parent == "root" {
+			qdisc.Root = true
+		} else {
+			qdisc.Parent = parent
+		}
+		return qdisc
+	}
+
+	var qdiscs []QdiscState
+	handle := fmt.Sprintf("%x:", major)
+	if !netem.IsZero() {
+		params := netem
+		qdiscs = append(qdiscs, place(QdiscState{Dev: dev, Kind: "netem", Handle: handle, Netem: &params}, parent))
+		parent, handle = handle+"1", fmt.Sprintf("%x:", major+0x100)
+	}
+	if bandwidth > 0 {
+		qdiscs = append(qdiscs, place(QdiscState{Dev: dev, Kind: "tbf", Handle: handle, Rate: bandwidth}, parent))
+	}
+	return qdiscs
+}
+
+// Calls returns every call made to the shaper so far.
+func (s *RecordingShaper) Calls() []ShaperCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ShaperCall{}, s.calls...)
+}
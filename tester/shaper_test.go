@@ -0,0 +1,105 @@
+package tester
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseNetemField(t *testing.T) {
+	var params NetemParams
+	fields := [][2]string{{"latency", "100ms"}, {"jitter", "20ms"}, {"loss", "1.5"}, {"duplicate", "0.5"}, {"reorder", "25"}}
+	for _, field := range fields {
+		if ok, err := parseNetemField(&params, field[0], field[1]); !ok || err != nil {
+			t.Fatalf("parseNetemField(%q, %q) = %v, %v", field[0], field[1], ok, err)
+		}
+	}
+	want := NetemParams{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 1.5, Duplicate: 0.5, Reorder: 25}
+	if params != want {
+		t.Errorf("params = %+v, want %+v", params, want)
+	}
+
+	if ok, err := parseNetemField(&params, "bandwidth", "10mbit"); ok || err != nil {
+		t.Errorf("parseNetemField(bandwidth) = %v, %v, want it to be left to the caller", ok, err)
+	}
+	if ok, err := parseNetemField(&params, "latency", "100"); !ok || err == nil {
+		t.Errorf("parseNetemField(latency, 100) = %v, %v, want an error", ok, err)
+	}
+}
+
+// The policy and trace parsers accept the same netem fields.
+func TestNetemFieldsAreSharedByParsers(t *testing.T) {
+	want := NetemParams{Latency: 80 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1, Duplicate: 2, Reorder: 3}
+	const fields = "latency=80ms:jitter=10ms:loss=1:duplicate=2:reorder=3"
+
+	peer, err := ParsePeerPolicy("cl-2-*:" + fields)
+	if err != nil || peer.Netem != want {
+		t.Errorf("ParsePeerPolicy() = %+v, %v, want netem %+v", peer.Netem, err, want)
+	}
+	group, err := ParseGroupPolicy("slow:pattern=cl-*:" + fields)
+	if err != nil || group.Netem != want {
+		t.Errorf("ParseGroupPolicy() = %+v, %v, want netem %+v", group.Netem, err, want)
+	}
+	point, err := traceFields(map[string]string{"slot": "0", "latency": "80ms", "jitter": "10ms", "loss": "1", "duplicate": "2", "reorder": "3"})
+	if err != nil || point.Netem != want {
+		t.Errorf("traceFields() = %+v, %v, want netem %+v", point.Netem, err, want)
+	}
+}
+
+func TestRecordingShaperInspectMatchesTcShaper(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+	}{
+		{name: "upload", limits: Limits{UploadBandwidth: 50_000_000}},
+		{name: "upload with netem", limits: Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 100 * time.Millisecond, Loss: 1}}},
+		{
+			name: "peers",
+			limits: Limits{
+				UploadBandwidth: 50_000_000,
+				Peers: []PeerLimits{
+					{IPs: []string{"10.0.0.2"}, Netem: NetemParams{Latency: 100 * time.Millisecond}},
+					{IPs: []string{"10.0.0.3"}, UploadBandwidth: 10_000_000},
+				},
+			},
+		},
+		{name: "ports", limits: Limits{Netem: NetemParams{Latency: 50 * time.Millisecond}, Ports: []Port{{Number: 9000, Protocol: PortProtocolTCP}}}},
+		{name: "policed download", limits: Limits{DownloadBandwidth: 20_000_000}},
+		{name: "ifb download with netem", limits: Limits{DownloadBandwidth: 20_000_000, DownloadLimiter: DownloadLimiterIFB, DownloadNetem: NetemParams{Latency: 30 * time.Millisecond}}},
+	}
+	placement := func(state *TcState) []string {
+		var qdiscs []string
+		for _, qdisc := range state.Qdiscs {
+			qdiscs = append(qdiscs, fmt.Sprintf("%s %s %s parent=%s root=%t", qdisc.Dev, qdisc.Kind, qdisc.Handle, qdisc.Parent, qdisc.Root))
+		}
+		slices.Sort(qdiscs)
+		return qdiscs
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newExecService(newTcRunner().exec)
+			if err := NewTcShaper("eth1").Apply(service, tt.limits); err != nil {
+				t.Fatalf("TcShaper.Apply() error = %v", err)
+			}
+			installed, err := GetTcState(service, "eth1")
+			if err != nil {
+				t.Fatalf("GetTcState() error = %v", err)
+			}
+
+			shaper := NewRecordingShaper("eth1")
+			shaper.Apply(service, tt.limits)
+			recorded, err := shaper.Inspect(service)
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			if err := recorded.Verify(tt.limits); err != nil {
+				t.Errorf("Verify() of the recorded state error = %v", err)
+			}
+			if got, want := placement(recorded), placement(installed); !slices.Equal(got, want) {
+				t.Errorf("recorded qdiscs = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/starlark_run_config"
+	"github.com/pkg/errors"
+)
+
+const (
+	blobSpammerServiceName = "blob-benchmarks-spamoor"
+	// blobSpammerImage is pinned so that the spammer's flags and behaviour don't change between runs.
+	blobSpammerImage = "ethpandaops/spamoor:v1.1.0"
+
+	// DefaultBlobSpammerPrivateKey is pre-funded account 5 from ethereum-package
+	// (0xAe95d8DA9244C37CaC0a3e16BA966a8e852Bb6D6). The enclave's own spamoor_blob service uses a
+	// different account, so the nonces don't collide.
+	DefaultBlobSpammerPrivateKey = "27515f805127bebad2fb9b183508bdacb8c763da16f54e0678b16e8f28ef3fff"
+)
+
+// Each transaction carries a single blob, so the throughput in transactions per slot is the number
+// of blobs we expect in each block.
+const addBlobSpammerScript = `
+def run(plan, args):
+    plan.add_service(
+        name = args["name"],
+        config = ServiceConfig(
+            image = args["image"],
+            cmd = [
+                "blob",
+                "--privkey=" + args["privkey"],
+                "--rpchost=" + args["rpc_url"],
+                "--sidecars=1",
+                "--throughput=" + str(args["blobs_per_block"]),
+                "--max-pending=" + str(args["blobs_per_block"] * 2),
+            ],
+        ),
+    )
+`
+
+const removeBlobSpammerScript = `
+def run(plan, args):
+    plan.remove_service(name = args["name"])
+`
+
+// GetExecutionRPCURL returns the JSON-RPC URL of the execution client paired with a consensus client
+// service, which is the one with the same participant index.
+func GetExecutionRPCURL(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext) (string, error) {
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get services")
+	}
+
+	participant := participantIndex(string(service.GetServiceName()))
+	var executionServiceNames []string
+	for name := range serviceNames {
+		if strings.HasPrefix(string(name), "el-") && participantIndex(string(name)) == participant {
+			executionServiceNames = append(executionServiceNames, string(name))
+		}
+	}
+	sort.Strings(executionServiceNames)
+
+	for _, name := range executionServiceNames {
+		service, err := enclaveContext.GetServiceContext(name)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get execution service context")
+		}
+
+		rpcPort, ok := service.GetPrivatePorts()["rpc"]
+		if !ok {
+			continue
+		}
+
+		return fmt.Sprintf("http://%s:%d", service.GetPrivateIPAddress(), rpcPort.GetNumber()), nil
+	}
+
+	return "", fmt.Errorf("no execution client with an rpc port found for %s", service.GetServiceName())
+}
+
+// BlobSpammerAddress returns the address of the account the spammer sends its transactions from.
+func BlobSpammerAddress(privateKey string) (common.Address, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil {
+		return common.Address{}, errors.Wrap(err, "invalid blob spammer private key")
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// StartBlobSpammer starts a spammer that sends its transactions to the execution client at rpcURL.
+func StartBlobSpammer(ctx context.Context, enclaveContext *enclaves.EnclaveContext, rpcURL string, privateKey string, blobsPerBlock uint) error {
+	params, err := json.Marshal(map[string]interface{}{
+		"name":            blobSpammerServiceName,
+		"image":           blobSpammerImage,
+		"privkey":         strings.TrimPrefix(privateKey, "0x"),
+		"rpc_url":         rpcURL,
+		"blobs_per_block": blobsPerBlock,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal blob spammer params")
+	}
+
+	log.Info("Starting blob spammer", "blobs_per_block", blobsPerBlock, "rpc_url", rpcURL)
+	_, err = enclaveContext.RunStarlarkScriptBlocking(ctx, addBlobSpammerScript, starlark_run_config.NewRunStarlarkConfig(
+		starlark_run_config.WithSerializedParams(string(params)),
+	))
+	if err != nil {
+		return errors.Wrap(err, "failed to add blob spammer service")
+	}
+
+	return nil
+}
+
+func StopBlobSpammer(ctx context.Context, enclaveContext *enclaves.EnclaveContext) error {
+	params, err := json.Marshal(map[string]interface{}{
+		"name": blobSpammerServiceName,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal blob spammer params")
+	}
+
+	log.Info("Stopping blob spammer")
+	_, err = enclaveContext.RunStarlarkScriptBlocking(ctx, removeBlobSpammerScript, starlark_run_config.NewRunStarlarkConfig(
+		starlark_run_config.WithSerializedParams(string(params)),
+	))
+	if err != nil {
+		return errors.Wrap(err, "failed to remove blob spammer service")
+	}
+
+	return nil
+}
+
+func UpdateBlobSpammer(ctx context.Context, enclaveContext *enclaves.EnclaveContext, rpcURL string, privateKey string, blobsPerBlock uint) error {
+	log.Info("Updating blob spammer", "blobs_per_block", blobsPerBlock)
+	if err := StopBlobSpammer(ctx, enclaveContext); err != nil {
+		return errors.Wrap(err, "failed to stop blob spammer")
+	}
+
+	if err := StartBlobSpammer(ctx, enclaveContext, rpcURL, privateKey, blobsPerBlock); err != nil {
+		return errors.Wrap(err, "failed to start blob spammer")
+	}
+
+	return nil
+}
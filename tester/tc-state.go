@@ -0,0 +1,409 @@
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// QdiscState is a qdisc as reported by `tc -s -j qdisc show`, with the statistics it has
+// accumulated since it was created.
+type QdiscState struct {
+	Dev    string `json:"dev"`
+	Kind   string `json:"kind"`
+	Handle string `json:"handle"`
+	Parent string `json:"parent,omitempty"`
+	Root   bool   `json:"root,omitempty"`
+
+	// Rate, Burst and Latency are only set for rate limiting qdiscs such as tbf. Rate is in bits per
+	// second and Burst is in bytes.
+	Rate    Bandwidth     `json:"rate,omitempty"`
+	Burst   uint          `json:"burst,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	// Netem is only set for netem qdiscs.
+	Netem *NetemParams `json:"netem,omitempty"`
+
+	Bytes      uint64 `json:"bytes"`
+	Packets    uint64 `json:"packets"`
+	Drops      uint64 `json:"drops"`
+	Overlimits uint64 `json:"overlimits"`
+	Requeues   uint64 `json:"requeues"`
+	Backlog    uint64 `json:"backlog"`
+	Qlen       uint64 `json:"qlen"`
+}
+
+// FilterAction is an action attached to an ingress filter, e.g. a policer or a redirect.
+type FilterAction struct {
+	Kind string `json:"kind"`
+	// Rate and Burst are set for policers. Rate is in bits per second and Burst is in bytes.
+	Rate  Bandwidth `json:"rate,omitempty"`
+	Burst uint      `json:"burst,omitempty"`
+	// RedirectDev is set for mirred actions.
+	RedirectDev string `json:"redirect_dev,omitempty"`
+}
+
+// TcState is the traffic control configuration in effect in a service.
+type TcState struct {
+	// Dev is the interface whose traffic is shaped.
+	Dev            string         `json:"dev"`
+	Qdiscs         []QdiscState   `json:"qdiscs"`
+	IngressActions []FilterAction `json:"ingress_actions,omitempty"`
+}
+
+type tcQdiscJSON struct {
+	Kind       string          `json:"kind"`
+	Handle     string          `json:"handle"`
+	Parent     string          `json:"parent"`
+	Root       bool            `json:"root"`
+	Options    json.RawMessage `json:"options"`
+	Bytes      uint64          `json:"bytes"`
+	Packets    uint64          `json:"packets"`
+	Drops      uint64          `json:"drops"`
+	Overlimits uint64          `json:"overlimits"`
+	Requeues   uint64          `json:"requeues"`
+	Backlog    uint64          `json:"backlog"`
+	Qlen       uint64          `json:"qlen"`
+}
+
+// tc reports rates in bytes per second, sizes in bytes and times in microseconds.
+type tcRateJSON struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+	Lat   float64 `json:"lat"`
+}
+
+// tc reports netem delays in seconds and probabilities as fractions rather than percentages.
+type tcNetemJSON struct {
+	Delay *struct {
+		Delay  float64 `json:"delay"`
+		Jitter float64 `json:"jitter"`
+	} `json:"delay"`
+	LossRandom *struct {
+		Loss float64 `json:"loss"`
+	} `json:"loss-random"`
+	Duplicate *struct {
+		Duplicate float64 `json:"duplicate"`
+	} `json:"duplicate"`
+	Reorder *struct {
+		Reorder float64 `json:"reorder"`
+	} `json:"reorder"`
+}
+
+func (n tcNetemJSON) params() *NetemParams {
+	params := &NetemParams{}
+	if n.Delay != nil {
+		params.Latency = time.Duration(n.Delay.Delay * float64(time.Second))
+		params.Jitter = time.Duration(n.Delay.Jitter * float64(time.Second))
+	}
+	if n.LossRandom != nil {
+		params.Loss = n.LossRandom.Loss * 100
+	}
+	if n.Duplicate != nil {
+		params.Duplicate = n.Duplicate.Duplicate * 100
+	}
+	if n.Reorder != nil {
+		params.Reorder = n.Reorder.Reorder * 100
+	}
+	return params
+}
+
+type tcFilterJSON struct {
+	Kind    string `json:"kind"`
+	Options struct {
+		Actions []struct {
+			Kind  string  `json:"kind"`
+			Rate  float64 `json:"rate"`
+			Burst float64 `json:"burst"`
+			ToDev string  `json:"to_dev"`
+		} `json:"actions"`
+	} `json:"options"`
+}
+
+// parseQdiscs parses the output of `tc -s -j qdisc show dev <dev>`.
+func parseQdiscs(dev string, output []byte) ([]QdiscState, error) {
+	var qdiscs []tcQdiscJSON
+	if err := json.Unmarshal(output, &qdiscs); err != nil {
+		return nil, errors.Wrap(err, "failed to parse qdiscs")
+	}
+
+	states := make([]QdiscState, 0, len(qdiscs))
+	for _, qdisc := range qdiscs {
+		state := QdiscState{
+			Dev:        dev,
+			Kind:       qdisc.Kind,
+			Handle:     qdisc.Handle,
+			Parent:     qdisc.Parent,
+			Root:       qdisc.Root,
+			Bytes:      qdisc.Bytes,
+			Packets:    qdisc.Packets,
+			Drops:      qdisc.Drops,
+			Overlimits: qdisc.Overlimits,
+			Requeues:   qdisc.Requeues,
+			Backlog:    qdisc.Backlog,
+			Qlen:       qdisc.Qlen,
+		}
+
+		if qdisc.Kind == "tbf" && len(qdisc.Options) > 0 {
+			var options tcRateJSON
+			if err := json.Unmarshal(qdisc.Options, &options); err != nil {
+				return nil, errors.Wrap(err, "failed to parse tbf options")
+			}
+			state.Rate = Bandwidth(options.Rate * 8)
+			state.Burst = uint(options.Burst)
+			state.Latency = time.Duration(options.Lat) * time.Microsecond
+		}
+		if qdisc.Kind == "netem" {
+			var options tcNetemJSON
+			if len(qdisc.Options) > 0 {
+				if err := json.Unmarshal(qdisc.Options, &options); err != nil {
+					return nil, errors.Wrap(err, "failed to parse netem options")
+				}
+			}
+			state.Netem = options.params()
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// parseFilterActions parses the output of `tc -j filter show dev <dev> parent ffff:`.
+func parseFilterActions(output []byte) ([]FilterAction, error) {
+	var filters []tcFilterJSON
+	if err := json.Unmarshal(output, &filters); err != nil {
+		return nil, errors.Wrap(err, "failed to parse filters")
+	}
+
+	var actions []FilterAction
+	for _, filter := range filters {
+		for _, action := range filter.Options.Actions {
+			actions = append(actions, FilterAction{
+				Kind:        action.Kind,
+				Rate:        Bandwidth(action.Rate * 8),
+				Burst:       uint(action.Burst),
+				RedirectDev: action.ToDev,
+			})
+		}
+	}
+
+	return actions, nil
+}
+
+// showQdiscs returns the qdiscs on dev, or none if the device doesn't exist.
+func showQdiscs(service *services.ServiceContext, dev string) ([]QdiscState, error) {
+	output, err := execCommand(service, fmt.Sprintf("tc -s -j qdisc show dev %s", dev), "show qdiscs")
+	if err != nil {
+		return nil, err
+	}
+	if output == "" {
+		return nil, nil
+	}
+	return parseQdiscs(dev, []byte(output))
+}
+
+// GetTcState reads back the qdiscs and ingress filters in effect on dev in the service, including
+// those on the IFB device if one exists.
+func GetTcState(service *services.ServiceContext, dev string) (*TcState, error) {
+	qdiscs, err := showQdiscs(service, dev)
+	if err != nil {
+		return nil, err
+	}
+	state := &TcState{Dev: dev, Qdiscs: qdiscs}
+
+	if _, err := execCommand(service, fmt.Sprintf("ip link show %s", ifbDevice), "show ifb device"); err == nil {
+		ifbQdiscs, err := showQdiscs(service, ifbDevice)
+		if err != nil {
+			return nil, err
+		}
+		state.Qdiscs = append(state.Qdiscs, ifbQdiscs...)
+	}
+
+	if state.HasIngressControl() {
+		output, err := execCommand(service, fmt.Sprintf("tc -j filter show dev %s parent ffff:", dev), "show ingress filters")
+		if err != nil {
+			return nil, err
+		}
+		if output != "" {
+			state.IngressActions, err = parseFilterActions([]byte(output))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return state, nil
+}
+
+func (s *TcState) qdisc(dev string, kind string) *QdiscState {
+	for i := range s.Qdiscs {
+		if s.Qdiscs[i].Dev == dev && s.Qdiscs[i].Kind == kind {
+			return &s.Qdiscs[i]
+		}
+	}
+	return nil
+}
+
+func (s *TcState) ingressAction(kind string) *FilterAction {
+	for i := range s.IngressActions {
+		if s.IngressActions[i].Kind == kind {
+			return &s.IngressActions[i]
+		}
+	}
+	return nil
+}
+
+// HasEgressControl reports whether a qdisc we install is at the root of the shaped interface.
+func (s *TcState) HasEgressControl() bool {
+	for _, qdisc := range s.Qdiscs {
+		if qdisc.Dev == s.Dev && qdisc.Root && (qdisc.Kind == "tbf" || qdisc.Kind == "netem" || qdisc.Kind == "prio") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TcState) HasIngressControl() bool {
+	return s.qdisc(s.Dev, "ingress") != nil
+}
+
+// qdiscAt returns the qdisc on dev with the given handle, e.g. "11:", if it's attached to parent,
+// which is either "root" or a class such as "1:1".
+func (s *TcState) qdiscAt(dev string, parent string, handle string) *QdiscState {
+	for i := range s.Qdiscs {
+		qdisc := &s.Qdiscs[i]
+		if qdisc.Dev != dev || qdisc.Handle != handle {
+			continue
+		}
+		if (parent == "root" && qdisc.Root) || (parent != "root" && qdisc.Parent == parent) {
+			return qdisc
+		}
+	}
+	return nil
+}
+
+// verifyShaping checks for the qdiscs setShapingQdiscs installs under parent with the handle major:.
+func (s *TcState) verifyShaping(dev string, parent string, major uint, bandwidth Bandwidth, netem NetemParams) error {
+	handle := fmt.Sprintf("%x:", major)
+	if !netem.IsZero() {
+		qdisc := s.qdiscAt(dev, parent, handle)
+		if qdisc == nil || qdisc.Kind != "netem" {
+			return fmt.Errorf("no netem qdisc %s under %s on %s", handle, parent, dev)
+		}
+		if err := verifyNetem(*qdisc.Netem, netem); err != nil {
+			return errors.Wrapf(err, "netem qdisc %s on %s", handle, dev)
+		}
+		// The rate limit is the netem qdisc's child.
+		parent, handle = handle+"1", fmt.Sprintf("%x:", major+0x100)
+	}
+	if bandwidth == 0 {
+		return nil
+	}
+
+	qdisc := s.qdiscAt(dev, parent, handle)
+	if qdisc == nil || qdisc.Kind != "tbf" {
+		return fmt.Errorf("no tbf qdisc %s under %s on %s", handle, parent, dev)
+	}
+	if !rateMatches(qdisc.Rate, bandwidth) {
+		return fmt.Errorf("tbf qdisc %s on %s limits traffic to %s, expected %s", handle, dev, qdisc.Rate, bandwidth)
+	}
+	return nil
+}
+
+// verifyNetem checks that the netem parameters tc reports match the expected ones, allowing for tc
+// keeping delays in its own time units and probabilities as fractions of 2^32.
+func verifyNetem(actual NetemParams, expected NetemParams) error {
+	durationMatches := func(actual time.Duration, expected time.Duration) bool {
+		return (actual - expected).Abs() <= expected/100+time.Microsecond
+	}
+	percentMatches := func(actual float64, expected float64) bool {
+		return math.Abs(actual-expected) <= 0.001
+	}
+
+	if !durationMatches(actual.Latency, expected.Latency) || !durationMatches(actual.Jitter, expected.Jitter) {
+		return fmt.Errorf("delay is %s ± %s, expected %s ± %s", actual.Latency, actual.Jitter, expected.Latency, expected.Jitter)
+	}
+	if !percentMatches(actual.Loss, expected.Loss) {
+		return fmt.Errorf("loss is %g%%, expected %g%%", actual.Loss, expected.Loss)
+	}
+	if !percentMatches(actual.Duplicate, expected.Duplicate) {
+		return fmt.Errorf("duplication is %g%%, expected %g%%", actual.Duplicate, expected.Duplicate)
+	}
+	if !percentMatches(actual.Reorder, expected.Reorder) {
+		return fmt.Errorf("reordering is %g%%, expected %g%%", actual.Reorder, expected.Reorder)
+	}
+	return nil
+}
+
+// rateMatches allows for the rounding tc does when converting rates to its internal units.
+func rateMatches(actual Bandwidth, expected Bandwidth) bool {
+	// tc keeps rates in whole bytes per second, so allow for that on top of the percentage.
+	tolerance := expected/100 + 8
+	return actual+tolerance >= expected && actual <= expected+tolerance
+}
+
+// verifyEgress checks for the qdiscs setEgressControl installs: the class's qdiscs at the root if
+// there's only one, and otherwise a prio qdisc with each class's qdiscs under its band.
+func (s *TcState) verifyEgress(limits Limits) error {
+	if !egressShaped(limits) {
+		return nil
+	}
+
+	classes, rest := egressClasses(limits)
+	if len(classes) == 0 {
+		return s.verifyShaping(s.Dev, "root", 1, rest.bandwidth, rest.netem)
+	}
+
+	if prio := s.qdiscAt(s.Dev, "root", "1:"); prio == nil || prio.Kind != "prio" {
+		return fmt.Errorf("no prio qdisc on %s to classify upload traffic", s.Dev)
+	}
+	for i, class := range append(classes, rest) {
+		band := i + 1
+		if err := s.verifyShaping(s.Dev, fmt.Sprintf("1:%x", band), uint(0x10+band), class.bandwidth, class.netem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks that the state enforces the given limits, with each qdisc in the place the shaper
+// puts it.
+func (s *TcState) Verify(limits Limits) error {
+	if err := s.verifyEgress(limits); err != nil {
+		return err
+	}
+
+	if !ingressShaped(limits) {
+		return nil
+	}
+
+	if !s.HasIngressControl() {
+		return fmt.Errorf("no ingress qdisc on %s", s.Dev)
+	}
+
+	switch limits.DownloadLimiter {
+	case DownloadLimiterIFB:
+		mirred := s.ingressAction("mirred")
+		if mirred == nil || mirred.RedirectDev != ifbDevice {
+			return fmt.Errorf("ingress traffic is not redirected to %s", ifbDevice)
+		}
+		if err := s.verifyShaping(ifbDevice, "root", 1, limits.DownloadBandwidth, limits.DownloadNetem); err != nil {
+			return err
+		}
+	default:
+		police := s.ingressAction("police")
+		if police == nil {
+			return fmt.Errorf("no ingress policer on %s", s.Dev)
+		}
+		// Older versions of tc don't report the policer's rate in JSON.
+		if expected := limits.DownloadBandwidth; police.Rate > 0 && !rateMatches(police.Rate, expected) {
+			return fmt.Errorf("download rate is %s, expected %s", police.Rate, expected)
+		}
+	}
+
+	return nil
+}
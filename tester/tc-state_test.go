@@ -0,0 +1,318 @@
+package tester
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcRunner keeps the qdiscs and ingress filter actions added with tc in a service and reports them
+// the way `tc -j` does. Like tc, it fails to delete a qdisc that isn't there.
+type tcRunner struct {
+	qdiscs  map[string][]map[string]interface{}
+	actions []map[string]interface{}
+	ifb     bool
+}
+
+func newTcRunner() *tcRunner {
+	return &tcRunner{qdiscs: make(map[string][]map[string]interface{})}
+}
+
+func (r *tcRunner) exec(command []string) (int32, string) {
+	joined := strings.Join(command, " ")
+	switch {
+	case strings.HasPrefix(joined, "tc -s -j qdisc show dev "):
+		qdiscs := r.qdiscs[command[len(command)-1]]
+		if len(qdiscs) == 0 {
+			return 0, ""
+		}
+		output, _ := json.Marshal(qdiscs)
+		return 0, string(output)
+	case strings.HasPrefix(joined, "tc -j filter show "):
+		output, _ := json.Marshal([]interface{}{map[string]interface{}{
+			"kind":    "u32",
+			"options": map[string]interface{}{"actions": r.actions},
+		}})
+		return 0, string(output)
+	case joined == "ip link show ifb0" && !r.ifb:
+		return 1, `Device "ifb0" does not exist.`
+	case joined == "ip link add ifb0 type ifb":
+		r.ifb = true
+	case joined == "ip link del ifb0":
+		if !r.ifb {
+			return 1, `Cannot find device "ifb0"`
+		}
+		r.ifb = false
+		delete(r.qdiscs, "ifb0")
+	case strings.HasPrefix(joined, "tc qdisc add "):
+		r.addQdisc(command[4:])
+	case strings.HasPrefix(joined, "tc qdisc del "):
+		return r.deleteQdisc(command[4], command[5] == "root")
+	case strings.HasPrefix(joined, "tc filter add "):
+		if slices.Contains(command, "mirred") {
+			r.actions = append(r.actions, map[string]interface{}{"kind": "mirred", "to_dev": command[len(command)-1]})
+		} else if i := slices.Index(command, "rate"); i >= 0 {
+			rate, _ := ParseBandwidth(command[i+1])
+			r.actions = append(r.actions, map[string]interface{}{"kind": "police", "rate": float64(rate) / 8})
+		}
+	}
+	return 0, ""
+}
+
+// deleteQdisc deletes either the root qdisc of dev and everything under it, or its ingress qdisc and
+// filters.
+func (r *tcRunner) deleteQdisc(dev string, root bool) (int32, string) {
+	kept := r.qdiscs[dev][:0]
+	deleted := false
+	for _, qdisc := range r.qdiscs[dev] {
+		if (qdisc["kind"] == "ingress") != root {
+			deleted = true
+			continue
+		}
+		kept = append(kept, qdisc)
+	}
+	if !deleted {
+		if root {
+			return 2, "Error: Cannot delete qdisc with handle of zero."
+		}
+		return 2, "Error: Cannot find specified qdisc on specified device."
+	}
+	r.qdiscs[dev] = kept
+	if !root {
+		r.actions = nil
+	}
+	return 0, ""
+}
+
+// addQdisc records a qdisc from the arguments of `tc qdisc add dev <dev>`, reporting its options in
+// tc's units: bytes per second for rates, seconds for delays and fractions for probabilities.
+func (r *tcRunner) addQdisc(args []string) {
+	dev, args := args[0], args[1:]
+	qdisc := make(map[string]interface{})
+	switch args[0] {
+	case "root":
+		qdisc["root"] = true
+		args = args[1:]
+	case "parent":
+		qdisc["parent"] = args[1]
+		args = args[2:]
+	}
+	qdisc["handle"] = args[1]
+	qdisc["kind"] = args[2]
+	options := args[3:]
+
+	switch args[2] {
+	case "tbf":
+		rate, _ := ParseBandwidth(options[1])
+		qdisc["options"] = map[string]interface{}{"rate": float64(rate) / 8, "burst": 16384, "lat": 50000}
+	case "netem":
+		netem := map[string]interface{}{"limit": 1000}
+		for i := 0; i < len(options); i++ {
+			switch options[i] {
+			case "delay":
+				delay, _ := time.ParseDuration(options[i+1])
+				jitter := time.Duration(0)
+				if i+2 < len(options) && strings.HasSuffix(options[i+2], "us") {
+					jitter, _ = time.ParseDuration(options[i+2])
+				}
+				netem["delay"] = map[string]interface{}{"delay": delay.Seconds(), "jitter": jitter.Seconds(), "correlation": 0}
+			case "loss", "duplicate", "reorder":
+				percentage, _ := strconv.ParseFloat(strings.TrimSuffix(options[i+1], "%"), 64)
+				key := options[i]
+				if key == "loss" {
+					key = "loss-random"
+				}
+				netem[key] = map[string]interface{}{options[i]: percentage / 100, "correlation": 0}
+			}
+		}
+		qdisc["options"] = netem
+	}
+	r.qdiscs[dev] = append(r.qdiscs[dev], qdisc)
+}
+
+func TestParseQdiscsNetem(t *testing.T) {
+	output := `[
+		{"kind":"prio","handle":"1:","root":true,"refcnt":2,"options":{"bands":3}},
+		{"kind":"netem","handle":"11:","parent":"1:1","options":{"limit":1000,"delay":{"delay":0.1,"jitter":0.01,"correlation":0},"loss-random":{"loss":0.015,"correlation":0},"ecn":false,"gap":0}},
+		{"kind":"tbf","handle":"111:","parent":"11:1","options":{"rate":1250000,"burst":16384,"lat":50000}}
+	]`
+	qdiscs, err := parseQdiscs("eth0", []byte(output))
+	if err != nil {
+		t.Fatalf("parseQdiscs() error = %v", err)
+	}
+	if len(qdiscs) != 3 {
+		t.Fatalf("got %d qdiscs, want 3", len(qdiscs))
+	}
+
+	netem := qdiscs[1]
+	if netem.Handle != "11:" || netem.Parent != "1:1" || netem.Netem == nil {
+		t.Fatalf("netem qdisc = %+v", netem)
+	}
+	if err := verifyNetem(*netem.Netem, NetemParams{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1.5}); err != nil {
+		t.Errorf("netem parameters = %+v: %v", *netem.Netem, err)
+	}
+	if tbf := qdiscs[2]; tbf.Parent != "11:1" || tbf.Rate != 10_000_000 || tbf.Netem != nil {
+		t.Errorf("tbf qdisc = %+v", tbf)
+	}
+}
+
+func TestTcShaperVerifiesAppliedLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+	}{
+		{
+			name:   "upload",
+			limits: Limits{UploadBandwidth: 50_000_000},
+		},
+		{
+			name:   "upload with netem",
+			limits: Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1}},
+		},
+		{
+			name: "peers",
+			limits: Limits{
+				UploadBandwidth: 50_000_000,
+				Peers: []PeerLimits{
+					{IPs: []string{"10.0.0.2"}, Netem: NetemParams{Latency: 100 * time.Millisecond}},
+					{IPs: []string{"10.0.0.3"}, UploadBandwidth: 10_000_000, Netem: NetemParams{Latency: 200 * time.Millisecond, Loss: 2}},
+				},
+			},
+		},
+		{
+			name:   "ports",
+			limits: Limits{Netem: NetemParams{Latency: 50 * time.Millisecond}, Ports: []Port{{Number: 9000, Protocol: PortProtocolTCP}}},
+		},
+		{
+			name:   "policed download",
+			limits: Limits{DownloadBandwidth: 20_000_000},
+		},
+		{
+			name: "ifb download with netem",
+			limits: Limits{
+				DownloadBandwidth: 20_000_000,
+				DownloadLimiter:   DownloadLimiterIFB,
+				DownloadNetem:     NetemParams{Latency: 30 * time.Millisecond, Duplicate: 0.5, Reorder: 25},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shaper := NewTcShaper("eth0")
+			if err := shaper.Apply(newExecService(newTcRunner().exec), tt.limits); err != nil {
+				t.Errorf("Apply() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksEachQdiscInPlace(t *testing.T) {
+	peers := []PeerLimits{
+		{IPs: []string{"10.0.0.2"}, Netem: NetemParams{Latency: 100 * time.Millisecond}},
+		{IPs: []string{"10.0.0.3"}, Netem: NetemParams{Latency: 200 * time.Millisecond, Loss: 2}},
+	}
+	applied := Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}, Peers: peers}
+
+	runner := newTcRunner()
+	service := newExecService(runner.exec)
+	if err := NewTcShaper("eth0").Apply(service, applied); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	state, err := GetTcState(service, "eth0")
+	if err != nil {
+		t.Fatalf("GetTcState() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr string
+	}{
+		{
+			name:    "peers swapped",
+			limits:  Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}, Peers: []PeerLimits{peers[1], peers[0]}},
+			wantErr: "netem qdisc 11: on eth0: delay is 100ms",
+		},
+		{
+			name:    "different loss",
+			limits:  Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}, Peers: []PeerLimits{peers[0], {IPs: []string{"10.0.0.3"}, Netem: NetemParams{Latency: 200 * time.Millisecond, Loss: 5}}}},
+			wantErr: "loss is 2%, expected 5%",
+		},
+		{
+			name:    "different rate",
+			limits:  Limits{UploadBandwidth: 20_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}, Peers: peers},
+			wantErr: "limits traffic to 50mbit, expected 20mbit",
+		},
+		{
+			name:    "not classified",
+			limits:  Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}},
+			wantErr: "no netem qdisc 1: under root on eth0",
+		},
+		{
+			name:    "download not shaped",
+			limits:  Limits{UploadBandwidth: 50_000_000, Netem: NetemParams{Latency: 20 * time.Millisecond}, Peers: peers, DownloadBandwidth: 20_000_000},
+			wantErr: "no ingress qdisc on eth0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := state.Verify(tt.limits)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := state.Verify(applied); err != nil {
+		t.Errorf("Verify() of the applied limits error = %v", err)
+	}
+}
+
+func TestTcShaperRemovesOnlyInstalledControls(t *testing.T) {
+	upload := Limits{UploadBandwidth: 50_000_000}
+	download := Limits{DownloadBandwidth: 20_000_000, DownloadLimiter: DownloadLimiterIFB}
+	ports := []Port{{Number: 9000, Protocol: PortProtocolTCP}}
+
+	tests := []struct {
+		name   string
+		apply  *Limits
+		update *Limits
+	}{
+		{name: "nothing applied"},
+		{name: "upload only", apply: &upload},
+		{name: "download only", apply: &download},
+		{name: "upload only scope change", apply: &upload, update: &Limits{UploadBandwidth: 50_000_000, Ports: ports}},
+		{name: "download only scope change", apply: &download, update: &Limits{DownloadBandwidth: 20_000_000, DownloadLimiter: DownloadLimiterIFB, Ports: ports}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := newTcRunner()
+			service := newExecService(runner.exec)
+			shaper := NewTcShaper("eth0")
+			if tt.apply != nil {
+				if err := shaper.Apply(service, *tt.apply); err != nil {
+					t.Fatalf("Apply() error = %v", err)
+				}
+			}
+			if tt.update != nil {
+				if err := shaper.Update(service, *tt.update); err != nil {
+					t.Fatalf("Update() error = %v", err)
+				}
+			}
+
+			if err := shaper.Remove(service); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+			state, err := GetTcState(service, "eth0")
+			if err != nil {
+				t.Fatalf("GetTcState() error = %v", err)
+			}
+			if len(state.Qdiscs) != 0 || len(state.IngressActions) != 0 {
+				t.Errorf("controls left after Remove(): %+v", state)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tester
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+)
+
+// TrafficCounters are the cumulative qdisc counters for one direction of a service's traffic.
+type TrafficCounters struct {
+	Bytes      uint64 `json:"bytes"`
+	Packets    uint64 `json:"packets"`
+	Drops      uint64 `json:"drops"`
+	Overlimits uint64 `json:"overlimits"`
+}
+
+// TcSample is a reading of the service's traffic counters taken during a step.
+type TcSample struct {
+	Slot      uint64          `json:"slot"`
+	Timestamp time.Time       `json:"timestamp"`
+	Upload    TrafficCounters `json:"upload"`
+	Download  TrafficCounters `json:"download"`
+}
+
+// DirectionStats summarizes one direction of traffic over a step.
+type DirectionStats struct {
+	// Throughput is the achieved rate in bits per second.
+	Throughput Bandwidth `json:"throughput"`
+	Packets    uint64    `json:"packets"`
+	Drops      uint64    `json:"drops"`
+	Overlimits uint64    `json:"overlimits"`
+	// DropRate is the fraction of packets that were dropped.
+	DropRate float64 `json:"drop_rate"`
+}
+
+// StepStats are the traffic statistics sampled every slot during a step.
+type StepStats struct {
+	Samples  []TcSample     `json:"samples"`
+	Upload   DirectionStats `json:"upload"`
+	Download DirectionStats `json:"download"`
+}
+
+// UploadCounters returns the counters of the qdiscs shaping the interface's egress traffic.
+func (s *TcState) UploadCounters() TrafficCounters {
+	return s.devCounters(s.Dev)
+}
+
+// DownloadCounters returns the counters of the IFB device's qdiscs if ingress traffic is redirected
+// to one, or otherwise those of the ingress qdisc. A policer counts the packets it drops as received.
+func (s *TcState) DownloadCounters() TrafficCounters {
+	for _, qdisc := range s.Qdiscs {
+		if qdisc.Dev == ifbDevice {
+			return s.devCounters(ifbDevice)
+		}
+	}
+
+	ingress := s.qdisc(s.Dev, "ingress")
+	if ingress == nil {
+		return TrafficCounters{}
+	}
+	return TrafficCounters{
+		Bytes:      ingress.Bytes,
+		Packets:    ingress.Packets,
+		Drops:      ingress.Drops,
+		Overlimits: ingress.Overlimits,
+	}
+}
+
+// devCounters takes bytes, packets and drops from the outermost shaping qdiscs, which count the
+// drops of the qdiscs under them, and sums overlimits over every qdisc. When traffic is classified
+// by a prio qdisc, the outermost shaping qdiscs are those directly under its bands, so only the
+// shaped classes are counted.
+func (s *TcState) devCounters(dev string) TrafficCounters {
+	classified := false
+	for _, qdisc := range s.Qdiscs {
+		if qdisc.Dev == dev && qdisc.Root && qdisc.Kind == "prio" {
+			classified = true
+		}
+	}
+
+	var counters TrafficCounters
+	for _, qdisc := range s.Qdiscs {
+		if qdisc.Dev != dev || qdisc.Kind == "ingress" {
+			continue
+		}
+
+		outermost := qdisc.Root
+		if classified {
+			outermost = strings.HasPrefix(qdisc.Parent, "1:") && (qdisc.Kind == "tbf" || qdisc.Kind == "netem")
+		}
+		if outermost {
+			counters.Bytes += qdisc.Bytes
+			counters.Packets += qdisc.Packets
+			counters.Drops += qdisc.Drops
+		}
+		counters.Overlimits += qdisc.Overlimits
+	}
+	return counters
+}
+
+// counterDelta is the increase in a counter between two samples. Counters restart from zero when a
+// qdisc is replaced, in which case the later value is the whole increase.
+func counterDelta(before uint64, after uint64) uint64 {
+	if after < before {
+		return after
+	}
+	return after - before
+}
+
+func summarize(samples []TcSample, counters func(TcSample) TrafficCounters) DirectionStats {
+	var stats DirectionStats
+	if len(samples) < 2 {
+		return stats
+	}
+
+	var bytes uint64
+	for i := 1; i < len(samples); i++ {
+		before, after := counters(samples[i-1]), counters(samples[i])
+		bytes += counterDelta(before.Bytes, after.Bytes)
+		stats.Packets += counterDelta(before.Packets, after.Packets)
+		stats.Drops += counterDelta(before.Drops, after.Drops)
+		stats.Overlimits += counterDelta(before.Overlimits, after.Overlimits)
+	}
+
+	elapsed := samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp)
+	if elapsed > 0 {
+		stats.Throughput = Bandwidth(float64(bytes*8) / elapsed.Seconds())
+	}
+	if total := stats.Packets + stats.Drops; total > 0 {
+		stats.DropRate = float64(stats.Drops) / float64(total)
+	}
+	return stats
+}
+
+// statsCollector samples the service's traffic counters every slot and summarizes them per step.
+type statsCollector struct {
+	shaper     Shaper
+	service    *services.ServiceContext
+	chainClock *ChainClock
+	samples    []TcSample
+}
+
+func newStatsCollector(shaper Shaper, service *services.ServiceContext, chainClock *ChainClock) *statsCollector {
+	return &statsCollector{
+		shaper:     shaper,
+		service:    service,
+		chainClock: chainClock,
+	}
+}
+
+// sample records the current counters and returns the state they were read from. A failure is
+// logged rather than failing the step, in which case the state is nil.
+func (c *statsCollector) sample(now time.Time) *TcState {
+	state, err := c.shaper.Inspect(c.service)
+	if err != nil {
+		log.Error("Failed to sample bandwidth controls", "error", err)
+		return nil
+	}
+
+	c.samples = append(c.samples, TcSample{
+		Slot:      c.chainClock.SlotAt(now),
+		Timestamp: now,
+		Upload:    state.UploadCounters(),
+		Download:  state.DownloadCounters(),
+	})
+	return state
+}
+
+// finish summarizes the samples taken since the last call and starts a new step.
+func (c *statsCollector) finish() *StepStats {
+	stats := &StepStats{
+		Samples:  c.samples,
+		Upload:   summarize(c.samples, func(sample TcSample) TrafficCounters { return sample.Upload }),
+		Download: summarize(c.samples, func(sample TcSample) TrafficCounters { return sample.Download }),
+	}
+	c.samples = nil
+
+	log.Info("Step traffic statistics",
+		"upload_throughput", stats.Upload.Throughput.String(), "upload_drop_rate", stats.Upload.DropRate,
+		"download_throughput", stats.Download.Throughput.String(), "download_drop_rate", stats.Download.DropRate)
+	return stats
+}
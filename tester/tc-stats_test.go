@@ -0,0 +1,150 @@
+package tester
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTcStateCounters(t *testing.T) {
+	// Fixtures are the output of `tc -s -j qdisc show dev <dev>` for each device.
+	tests := []struct {
+		name         string
+		eth0         string
+		ifb0         string
+		wantUpload   TrafficCounters
+		wantDownload TrafficCounters
+	}{
+		{
+			name:       "unshaped",
+			eth0:       `[{"kind":"noqueue","handle":"0:","root":true,"refcnt":2,"options":{},"bytes":0,"packets":0,"drops":0,"overlimits":0,"requeues":0,"backlog":0,"qlen":0}]`,
+			wantUpload: TrafficCounters{},
+		},
+		{
+			name:       "root tbf",
+			eth0:       `[{"kind":"tbf","handle":"1:","root":true,"refcnt":2,"options":{"rate":6250000,"burst":16384,"lat":50000},"bytes":1500000,"packets":1000,"drops":12,"overlimits":340,"requeues":0,"backlog":0,"qlen":0}]`,
+			wantUpload: TrafficCounters{Bytes: 1_500_000, Packets: 1000, Drops: 12, Overlimits: 340},
+		},
+		{
+			name: "netem over tbf",
+			eth0: `[
+				{"kind":"netem","handle":"1:","root":true,"refcnt":2,"options":{"limit":1000,"delay":{"delay":0.1,"jitter":0,"correlation":0},"ecn":false,"gap":0},"bytes":900000,"packets":600,"drops":5,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"tbf","handle":"101:","parent":"1:1","options":{"rate":6250000,"burst":16384,"lat":50000},"bytes":890000,"packets":590,"drops":3,"overlimits":75,"requeues":0,"backlog":1514,"qlen":1}
+			]`,
+			wantUpload: TrafficCounters{Bytes: 900_000, Packets: 600, Drops: 5, Overlimits: 75},
+		},
+		{
+			name: "classified by prio",
+			eth0: `[
+				{"kind":"prio","handle":"1:","root":true,"refcnt":2,"options":{"bands":3,"priomap":[2,2,2,2,2,2,2,2,2,2,2,2,2,2,2,2],"multiqueue":false},"bytes":5000000,"packets":4000,"drops":9,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"netem","handle":"11:","parent":"1:1","options":{"limit":1000,"delay":{"delay":0.1,"jitter":0,"correlation":0},"ecn":false,"gap":0},"bytes":200000,"packets":150,"drops":1,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"tbf","handle":"111:","parent":"11:1","options":{"rate":1250000,"burst":16384,"lat":50000},"bytes":199000,"packets":149,"drops":4,"overlimits":20,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"tbf","handle":"13:","parent":"1:3","options":{"rate":6250000,"burst":16384,"lat":50000},"bytes":4000000,"packets":3000,"drops":8,"overlimits":60,"requeues":0,"backlog":0,"qlen":0}
+			]`,
+			wantUpload: TrafficCounters{Bytes: 4_200_000, Packets: 3150, Drops: 9, Overlimits: 80},
+		},
+		{
+			name: "policed download",
+			eth0: `[
+				{"kind":"tbf","handle":"1:","root":true,"refcnt":2,"options":{"rate":6250000,"burst":16384,"lat":50000},"bytes":1500000,"packets":1000,"drops":0,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"ingress","handle":"ffff:","parent":"ffff:fff1","options":{},"bytes":3000000,"packets":2500,"drops":40,"overlimits":0,"requeues":0,"backlog":0,"qlen":0}
+			]`,
+			wantUpload:   TrafficCounters{Bytes: 1_500_000, Packets: 1000},
+			wantDownload: TrafficCounters{Bytes: 3_000_000, Packets: 2500, Drops: 40},
+		},
+		{
+			name: "ifb download",
+			eth0: `[
+				{"kind":"noqueue","handle":"0:","root":true,"refcnt":2,"options":{},"bytes":0,"packets":0,"drops":0,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"ingress","handle":"ffff:","parent":"ffff:fff1","options":{},"bytes":3000000,"packets":2500,"drops":0,"overlimits":0,"requeues":0,"backlog":0,"qlen":0}
+			]`,
+			ifb0: `[
+				{"kind":"netem","handle":"1:","root":true,"refcnt":2,"options":{"limit":1000,"delay":{"delay":0.03,"jitter":0,"correlation":0},"ecn":false,"gap":0},"bytes":2900000,"packets":2400,"drops":30,"overlimits":0,"requeues":0,"backlog":0,"qlen":0},
+				{"kind":"tbf","handle":"101:","parent":"1:1","options":{"rate":2500000,"burst":16384,"lat":50000},"bytes":2890000,"packets":2390,"drops":10,"overlimits":500,"requeues":0,"backlog":0,"qlen":0}
+			]`,
+			wantDownload: TrafficCounters{Bytes: 2_900_000, Packets: 2400, Drops: 30, Overlimits: 500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qdiscs, err := parseQdiscs("eth0", []byte(tt.eth0))
+			if err != nil {
+				t.Fatalf("parseQdiscs(eth0) error = %v", err)
+			}
+			state := &TcState{Dev: "eth0", Qdiscs: qdiscs}
+			if tt.ifb0 != "" {
+				ifbQdiscs, err := parseQdiscs(ifbDevice, []byte(tt.ifb0))
+				if err != nil {
+					t.Fatalf("parseQdiscs(ifb0) error = %v", err)
+				}
+				state.Qdiscs = append(state.Qdiscs, ifbQdiscs...)
+			}
+
+			if got := state.UploadCounters(); got != tt.wantUpload {
+				t.Errorf("UploadCounters() = %+v, want %+v", got, tt.wantUpload)
+			}
+			if got := state.DownloadCounters(); got != tt.wantDownload {
+				t.Errorf("DownloadCounters() = %+v, want %+v", got, tt.wantDownload)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	sample := func(seconds int, counters TrafficCounters) TcSample {
+		return TcSample{Timestamp: start.Add(time.Duration(seconds) * time.Second), Upload: counters}
+	}
+
+	tests := []struct {
+		name    string
+		samples []TcSample
+		want    DirectionStats
+	}{
+		{
+			name:    "one sample",
+			samples: []TcSample{sample(0, TrafficCounters{Bytes: 1000, Packets: 10})},
+			want:    DirectionStats{},
+		},
+		{
+			name: "steady",
+			samples: []TcSample{
+				sample(0, TrafficCounters{Bytes: 1_000_000, Packets: 1000, Drops: 10}),
+				sample(12, TrafficCounters{Bytes: 4_000_000, Packets: 3000, Drops: 30, Overlimits: 5}),
+				sample(24, TrafficCounters{Bytes: 7_000_000, Packets: 5000, Drops: 50, Overlimits: 15}),
+			},
+			// 6MB in 24s is 2mbit, and 40 of the 4040 packets were dropped.
+			want: DirectionStats{Throughput: 2_000_000, Packets: 4000, Drops: 40, Overlimits: 15, DropRate: 40.0 / 4040},
+		},
+		{
+			name: "qdisc replaced",
+			samples: []TcSample{
+				sample(0, TrafficCounters{Bytes: 5_000_000, Packets: 4000, Drops: 100}),
+				sample(12, TrafficCounters{Bytes: 6_500_000, Packets: 5000, Drops: 100}),
+				// The counters restart from zero when the limits are updated.
+				sample(24, TrafficCounters{Bytes: 1_500_000, Packets: 1000}),
+			},
+			want: DirectionStats{Throughput: 1_000_000, Packets: 2000},
+		},
+		{
+			name: "no time elapsed",
+			samples: []TcSample{
+				sample(0, TrafficCounters{Bytes: 0, Packets: 0}),
+				sample(0, TrafficCounters{Bytes: 1000, Packets: 1, Drops: 1}),
+			},
+			want: DirectionStats{Packets: 1, Drops: 1, DropRate: 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(tt.samples, func(sample TcSample) TrafficCounters { return sample.Upload })
+			if math.Abs(got.DropRate-tt.want.DropRate) > 1e-12 {
+				t.Errorf("drop rate = %g, want %g", got.DropRate, tt.want.DropRate)
+			}
+			got.DropRate = tt.want.DropRate
+			if got != tt.want {
+				t.Errorf("summarize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethpandaops/panda-pulse/pkg/checks"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+type TraceReplayTestConfig struct {
+	enclaveContext *enclaves.EnclaveContext
+	trace          []TracePoint
+	options        TestOptions
+}
+
+type TraceReplayTest struct {
+	cfg          TraceReplayTestConfig
+	ports        []Port
+	peers        []PeerLimits
+	passingSteps uint
+	report       Report
+}
+
+// NewTraceReplayTest returns a test that replays a trace of network conditions against the service
+// under test, running the checks every step until the last point has been held for a step.
+func NewTraceReplayTest(enclaveContext *enclaves.EnclaveContext, trace []TracePoint, options TestOptions) *TraceReplayTest {
+	return &TraceReplayTest{
+		cfg: TraceReplayTestConfig{
+			enclaveContext: enclaveContext,
+			trace:          trace,
+			options:        options,
+		},
+		report: Report{Test: "trace"},
+	}
+}
+
+// PassingSteps returns the number of steps that passed every check.
+func (t *TraceReplayTest) PassingSteps() uint {
+	return t.passingSteps
+}
+
+func (t *TraceReplayTest) Report() *Report {
+	return &t.report
+}
+
+// limits returns the limits for a point in the trace. The point's latency, jitter and loss replace
+// the test's network emulation if it has any.
+func (t *TraceReplayTest) limits(point TracePoint) Limits {
+	netem := t.cfg.options.Netem
+	if !point.Netem.IsZero() {
+		netem = point.Netem
+	}
+
+	return Limits{
+		UploadBandwidth:   point.UploadBandwidth,
+		DownloadBandwidth: point.DownloadBandwidth,
+		DownloadLimiter:   t.cfg.options.DownloadLimiter,
+		Netem:             netem,
+		DownloadNetem:     t.cfg.options.DownloadNetem,
+		Ports:             t.ports,
+		Peers:             t.peers,
+	}
+}
+
+func (t *TraceReplayTest) Run(ctx context.Context, doneChannel chan struct{}) error {
+	// Get the service for the node whose bandwidth we want to limit.
+	service, err := GetServiceUnderTest(t.cfg.enclaveContext, t.cfg.options.service())
+	if err != nil {
+		return errors.Wrap(err, "failed to get service under test")
+	}
+	t.report.Service = string(service.GetServiceName())
+
+	// Depending on the scope, shaping may apply to a different service than the one checked.
+	target, ports, err := ResolveScope(t.cfg.enclaveContext, service, t.cfg.options.Scope)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve shaping scope")
+	}
+	t.ports = ports
+	t.report.Scope = t.cfg.options.Scope
+	t.report.ShapedService = string(target.GetServiceName())
+
+	peers, err := ResolvePeerPolicies(t.cfg.enclaveContext, target, t.cfg.options.Peers)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve peer policies")
+	}
+	t.peers = peers
+	t.report.Peers = peers
+
+	groups, err := ResolveGroups(t.cfg.enclaveContext, service, t.cfg.options)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve service groups")
+	}
+	t.report.Groups = summarizeGroups(groups)
+	if len(groups) > 0 {
+		seed := t.cfg.options.Seed
+		t.report.Seed = &seed
+	}
+
+	// The checks listen to the service in the background until the test stops.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runner, err := newCheckRunner(ctx, t.cfg.enclaveContext, service, t.cfg.options, groupedServices(groups))
+	if err != nil {
+		return err
+	}
+
+	chainClock, err := GetChainClock(ctx, t.cfg.options.clock(), service)
+	if err != nil {
+		return errors.Wrap(err, "failed to get chain clock")
+	}
+
+	// Resolve time offsets now that the slot duration is known.
+	slots := make([]uint64, len(t.cfg.trace))
+	for i, point := range t.cfg.trace {
+		slots[i] = point.slot(chainClock.SlotDuration())
+		if i > 0 && slots[i] < slots[i-1] {
+			return fmt.Errorf("trace point %d is before the point preceding it", i)
+		}
+	}
+
+	schedule, err := newStepSchedule(chainClock, t.cfg.options.Fork, t.cfg.options.EpochsPerStep)
+	if err != nil {
+		return errors.Wrap(err, "failed to create step schedule")
+	}
+
+	return t.runSteps(ctx, service, target, groups, runner, chainClock, schedule, slots, doneChannel)
+}
+
+// runSteps replays the trace, whose points take effect at the given slot offsets, running the checks
+// every step until the last point has been held for a step.
+func (t *TraceReplayTest) runSteps(ctx context.Context, service *services.ServiceContext, target *services.ServiceContext, groups []ServiceGroup, runner checks.Runner, chainClock *ChainClock, schedule *stepSchedule, slots []uint64, doneChannel chan struct{}) error {
+	endSlot := slots[len(slots)-1] + uint64(t.cfg.options.EpochsPerStep)*chainClock.slotsPerEpoch
+
+	shaper := t.cfg.options.shaper()
+	evaluator := NewCheckEvaluator(service, t.cfg.options.CriticalChecks)
+	if verdict, err := evaluator.Evaluate(ctx, runner); err != nil {
+		log.Error("Failed to run checks", "error", err)
+	} else if !verdict.Passed {
+		log.Warn("Checks are failing before the trace is replayed", "failed_checks", verdict.FailedChecks)
+	}
+
+	current := 0
+	if err := shaper.Apply(target, t.limits(t.cfg.trace[current])); err != nil {
+		return errors.Wrap(err, "failed to apply bandwidth limits")
+	}
+	if err := applyGroups(shaper, groups); err != nil {
+		return err
+	}
+
+	// Start ticking at a slot boundary once the desired fork has been activated.
+	if !schedule.waitForStart(ctx) {
+		return nil
+	}
+	startSlot := chainClock.CurrentSlot()
+	applied := []AppliedLimits{{Slot: startSlot, Limits: t.limits(t.cfg.trace[current])}}
+	stats := newStatsCollector(shaper, target, chainClock)
+	stats.sample(chainClock.Now())
+	stepCount := uint(0)
+	ticker := chainClock.NewTicker(chainClock.SlotDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		now := chainClock.Now()
+		offset := chainClock.SlotAt(now) - startSlot
+
+		// Move to the latest point that has taken effect.
+		next := current
+		for next+1 < len(slots) && slots[next+1] <= offset {
+			next++
+		}
+		if next != current {
+			// Steps would otherwise be recorded against a point of the trace that never took effect.
+			if err := shaper.Update(target, t.limits(t.cfg.trace[next])); err != nil {
+				return errors.Wrapf(err, "failed to replay trace point %d", next)
+			}
+			current = next
+			applied = append(applied, AppliedLimits{Slot: chainClock.SlotAt(now), Limits: t.limits(t.cfg.trace[current])})
+			log.Info("Replayed trace point", "point", current, "slot_offset", offset, "upload", t.cfg.trace[current].UploadBandwidth.String(), "download", t.cfg.trace[current].DownloadBandwidth.String())
+		}
+
+		state := stats.sample(now)
+		if !schedule.stepDue(stepCount, now) {
+			continue
+		}
+
+		verdict, ok := evaluator.EvaluateStep(ctx, runner)
+		if !ok {
+			continue
+		}
+
+		t.report.AddStep(StepResult{
+			Epoch:     chainClock.EpochAt(now),
+			Timestamp: now,
+			Bandwidth: stepUploadBandwidth(applied),
+			Limits:    applied,
+			Verdict:   verdict,
+			Groups:    evaluateGroups(evaluator, runner, groups),
+			Tc:        state,
+			Stats:     stats.finish(),
+		})
+		if verdict.Passed {
+			t.passingSteps++
+		}
+		t.report.Result = t.passingSteps
+		stepCount++
+		stats.sample(chainClock.Now())
+		applied = []AppliedLimits{{Slot: chainClock.SlotAt(now), Limits: t.limits(t.cfg.trace[current])}}
+
+		if offset >= endSlot {
+			log.Info("Trace replayed, stopping test", "steps", stepCount, "passing_steps", t.passingSteps)
+			doneChannel <- struct{}{}
+			return nil
+		}
+	}
+}
+
+// stepUploadBandwidth returns the upload bandwidth of a step if it didn't change during the step, or
+// zero if it did, since no single bandwidth describes the step then.
+func stepUploadBandwidth(applied []AppliedLimits) Bandwidth {
+	for _, limits := range applied[1:] {
+		if limits.Limits.UploadBandwidth != applied[0].Limits.UploadBandwidth {
+			return 0
+		}
+	}
+	return applied[0].Limits.UploadBandwidth
+}
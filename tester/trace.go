@@ -0,0 +1,182 @@
+package tester
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TracePoint is the network conditions from a point in a trace until the next point. Zero
+// bandwidths leave that direction unlimited.
+type TracePoint struct {
+	// Slot is the number of slots after the start of the trace that the point takes effect. It is
+	// ignored if Offset is set.
+	Slot uint64
+	// Offset is the time after the start of the trace that the point takes effect.
+	Offset            time.Duration
+	UploadBandwidth   Bandwidth
+	DownloadBandwidth Bandwidth
+	Netem             NetemParams
+}
+
+// slot returns the slot offset at which the point takes effect.
+func (p TracePoint) slot(slotDuration time.Duration) uint64 {
+	if p.Offset > 0 {
+		return uint64(p.Offset / slotDuration)
+	}
+	return p.Slot
+}
+
+// traceFields parses a trace point from named string values, as found in either format.
+func traceFields(fields map[string]string) (TracePoint, error) {
+	var point TracePoint
+	for key, value := range fields {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "slot":
+			point.Slot, err = strconv.ParseUint(value, 10, 64)
+		case "time", "offset":
+			point.Offset, err = time.ParseDuration(value)
+		case "upload":
+			point.UploadBandwidth, err = ParseBandwidth(value)
+		case "download":
+			point.DownloadBandwidth, err = ParseBandwidth(value)
+		default:
+			var isNetem bool
+			isNetem, err = parseNetemField(&point.Netem, key, value)
+			if !isNetem {
+				return TracePoint{}, fmt.Errorf("unknown trace field %q", key)
+			}
+		}
+		if err != nil {
+			return TracePoint{}, errors.Wrapf(err, "invalid %s", key)
+		}
+	}
+
+	if strings.TrimSpace(fields["slot"]) == "" && strings.TrimSpace(fields["time"]) == "" && strings.TrimSpace(fields["offset"]) == "" {
+		return TracePoint{}, fmt.Errorf("point has no slot or time")
+	}
+	if err := point.Netem.Validate(); err != nil {
+		return TracePoint{}, err
+	}
+	return point, nil
+}
+
+func readCSVTrace(r io.Reader) ([]TracePoint, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CSV")
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("expected a header and at least one point")
+	}
+
+	header := records[0]
+	var points []TracePoint
+	for i, record := range records[1:] {
+		fields := make(map[string]string)
+		for j, name := range header {
+			fields[strings.ToLower(strings.TrimSpace(name))] = record[j]
+		}
+
+		point, err := traceFields(fields)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid point on line %d", i+2)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// readJSONTrace reads an array of objects with the same fields as the CSV format. Numbers and
+// strings are both accepted.
+func readJSONTrace(r io.Reader) ([]TracePoint, error) {
+	var objects []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON")
+	}
+
+	var points []TracePoint
+	for i, object := range objects {
+		fields := make(map[string]string)
+		for key, value := range object {
+			switch v := value.(type) {
+			case string:
+				fields[key] = v
+			case float64:
+				fields[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				return nil, fmt.Errorf("invalid %s in point %d", key, i)
+			}
+		}
+
+		point, err := traceFields(fields)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid point %d", i)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// LoadTrace reads a trace of network conditions from a CSV or JSON file. Each point has a slot (or
+// a time offset such as "90s") and any of upload and download (bits per second or with units such
+// as "50mbit"), latency, jitter, loss, duplicate and reorder. The points must be in order, starting
+// at slot zero.
+func LoadTrace(path string) ([]TracePoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open trace")
+	}
+	defer file.Close()
+
+	var points []TracePoint
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		points, err = readCSVTrace(file)
+	case ".json":
+		points, err = readJSONTrace(file)
+	default:
+		return nil, fmt.Errorf("unknown trace format %q, expected .csv or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load trace %s", path)
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("trace %s is empty", path)
+	}
+	if points[0].Slot != 0 || points[0].Offset != 0 {
+		return nil, fmt.Errorf("trace %s must start at slot 0", path)
+	}
+	// Points timed in slots can only be compared with points timed by offset once the slot duration
+	// is known, which the test checks when it starts.
+	for i := 1; i < len(points); i++ {
+		previous, point := points[i-1], points[i]
+		if (point.Offset > 0) != (previous.Offset > 0) {
+			continue
+		}
+		before := point.Slot < previous.Slot
+		if point.Offset > 0 {
+			before = point.Offset < previous.Offset
+		}
+		if before {
+			return nil, fmt.Errorf("trace %s: point %d is before the point preceding it", path, i)
+		}
+	}
+
+	return points, nil
+}
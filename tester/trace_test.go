@@ -0,0 +1,217 @@
+package tester
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []TracePoint
+		wantErr string
+	}{
+		{
+			name: "csv",
+			file: "trace.csv",
+			content: `slot,upload,download,latency,jitter,loss
+0,50mbit,100mbit,,,
+32,5mbit,20mbit,100ms,10ms,1
+64,20mbit,50mbit,40ms,,
+`,
+			want: []TracePoint{
+				{Slot: 0, UploadBandwidth: 50_000_000, DownloadBandwidth: 100_000_000},
+				{Slot: 32, UploadBandwidth: 5_000_000, DownloadBandwidth: 20_000_000, Netem: NetemParams{Latency: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1}},
+				{Slot: 64, UploadBandwidth: 20_000_000, DownloadBandwidth: 50_000_000, Netem: NetemParams{Latency: 40 * time.Millisecond}},
+			},
+		},
+		{
+			name: "csv with time offsets",
+			file: "trace.csv",
+			content: `Time, Upload
+0s,50mbit
+90s,5mbit
+`,
+			want: []TracePoint{
+				{UploadBandwidth: 50_000_000},
+				{Offset: 90 * time.Second, UploadBandwidth: 5_000_000},
+			},
+		},
+		{
+			name: "json",
+			file: "trace.json",
+			content: `[
+				{"slot": 0, "upload": "50mbit", "download": 100000000},
+				{"slot": 16, "upload": 5000000, "latency": "150ms", "loss": 0.5}
+			]`,
+			want: []TracePoint{
+				{Slot: 0, UploadBandwidth: 50_000_000, DownloadBandwidth: 100_000_000},
+				{Slot: 16, UploadBandwidth: 5_000_000, Netem: NetemParams{Latency: 150 * time.Millisecond, Loss: 0.5}},
+			},
+		},
+		{
+			name:    "unknown column",
+			file:    "trace.csv",
+			content: "slot,upload,bandwidth\n0,50mbit,10mbit\n",
+			wantErr: `unknown trace field "bandwidth"`,
+		},
+		{
+			name:    "unknown json field",
+			file:    "trace.json",
+			content: `[{"slot": 0, "rtt": "100ms"}]`,
+			wantErr: `unknown trace field "rtt"`,
+		},
+		{
+			name:    "no time column",
+			file:    "trace.csv",
+			content: "upload,download\n50mbit,100mbit\n",
+			wantErr: "point has no slot or time",
+		},
+		{
+			name:    "missing time",
+			file:    "trace.csv",
+			content: "time,upload\n0s,50mbit\n,5mbit\n",
+			wantErr: "invalid point on line 3: point has no slot or time",
+		},
+		{
+			name:    "unsorted slots",
+			file:    "trace.csv",
+			content: "slot,upload\n0,50mbit\n64,5mbit\n32,20mbit\n",
+			wantErr: "point 2 is before the point preceding it",
+		},
+		{
+			name:    "unsorted times",
+			file:    "trace.json",
+			content: `[{"time": "0s"}, {"time": "2m"}, {"time": "90s"}]`,
+			wantErr: "point 2 is before the point preceding it",
+		},
+		{
+			name:    "not starting at zero",
+			file:    "trace.csv",
+			content: "slot,upload\n8,50mbit\n",
+			wantErr: "must start at slot 0",
+		},
+		{
+			name:    "jitter without latency",
+			file:    "trace.csv",
+			content: "slot,jitter\n0,10ms\n",
+			wantErr: "jitter requires latency",
+		},
+		{
+			name:    "loss out of range",
+			file:    "trace.json",
+			content: `[{"slot": 0, "loss": 150}]`,
+			wantErr: "percentages must be between 0 and 100",
+		},
+		{
+			name:    "invalid latency",
+			file:    "trace.csv",
+			content: "slot,latency\n0,100\n",
+			wantErr: "invalid latency",
+		},
+		{
+			name:    "no points",
+			file:    "trace.csv",
+			content: "slot,upload\n",
+			wantErr: "expected a header and at least one point",
+		},
+		{
+			name:    "unknown format",
+			file:    "trace.txt",
+			content: "0 50mbit\n",
+			wantErr: "unknown trace format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadTrace(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadTrace() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadTrace() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadTrace() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceReplayRecordsEveryPointOfAStep(t *testing.T) {
+	chainClock, clock := newTestChainClock(10, map[string]uint64{"fulu": 0})
+	schedule, err := newStepSchedule(chainClock, "fulu", 1)
+	if err != nil {
+		t.Fatalf("newStepSchedule() error = %v", err)
+	}
+
+	trace := []TracePoint{
+		{Slot: 0, UploadBandwidth: 50_000_000},
+		{Slot: 8, UploadBandwidth: 10_000_000},
+		{Slot: 16, UploadBandwidth: 20_000_000},
+	}
+	shaper := NewRecordingShaper("eth0")
+	test := NewTraceReplayTest(nil, trace, TestOptions{Shaper: shaper, EpochsPerStep: 1})
+	runner := &fakeCheckRunner{passes: func() bool { return true }}
+	service := newTestService()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneChannel := make(chan struct{}, 1)
+	errChannel := make(chan error, 1)
+	go func() {
+		errChannel <- test.runSteps(context.Background(), service, service, nil, runner, chainClock, schedule, []uint64{0, 8, 16}, doneChannel)
+		cancel()
+	}()
+
+	for slots := 0; clock.BlockUntil(ctx, 1) == nil; slots++ {
+		if slots > 10_000 {
+			t.Fatal("replay didn't complete")
+		}
+		clock.Advance(chainClock.SlotDuration())
+	}
+	if err := <-errChannel; err != nil {
+		t.Fatalf("runSteps() error = %v", err)
+	}
+
+	steps := test.report.Steps
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+
+	var bandwidths []Bandwidth
+	for _, applied := range steps[0].Limits {
+		bandwidths = append(bandwidths, applied.Limits.UploadBandwidth)
+	}
+	if want := []Bandwidth{50_000_000, 10_000_000, 20_000_000}; !reflect.DeepEqual(bandwidths, want) {
+		t.Errorf("first step limits = %v, want %v", bandwidths, want)
+	}
+	startSlot := steps[0].Limits[0].Slot
+	if got := []uint64{steps[0].Limits[1].Slot - startSlot, steps[0].Limits[2].Slot - startSlot}; !reflect.DeepEqual(got, []uint64{8, 16}) {
+		t.Errorf("first step points took effect at slot offsets %v, want [8 16]", got)
+	}
+	if steps[0].Bandwidth != 0 {
+		t.Errorf("first step bandwidth = %s, want none since it changed", steps[0].Bandwidth)
+	}
+
+	if len(steps[1].Limits) != 1 || steps[1].Limits[0].Limits.UploadBandwidth != 20_000_000 {
+		t.Errorf("second step limits = %+v, want only the last point", steps[1].Limits)
+	}
+	if steps[1].Bandwidth != 20_000_000 {
+		t.Errorf("second step bandwidth = %s, want 20mbit", steps[1].Bandwidth)
+	}
+}
@@ -0,0 +1,144 @@
+package tester
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/enclaves"
+	"github.com/kurtosis-tech/kurtosis/api/golang/core/lib/services"
+	"github.com/pkg/errors"
+)
+
+// validatorRangesArtifact is the files artifact in which the ethereum-package records which
+// validators each participant runs.
+const validatorRangesArtifact = "validator-ranges"
+
+// ParseValidatorRange parses an inclusive range of validator indices such as "0-63", or a single
+// index.
+func ParseValidatorRange(s string) ([]uint64, error) {
+	first, last, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	start, err := strconv.ParseUint(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator range %q", s)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.ParseUint(strings.TrimSpace(last), 10, 64)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid validator range %q", s)
+		}
+	}
+
+	indices := make([]uint64, 0, end-start+1)
+	for index := start; index <= end; index++ {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// GetValidatorIndices returns the indices of the validators run by the service's participant, read
+// from the enclave's validator ranges.
+func GetValidatorIndices(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext) ([]uint64, error) {
+	archive, err := enclaveContext.DownloadFilesArtifact(context.Background(), validatorRangesArtifact)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", validatorRangesArtifact)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", validatorRangesArtifact)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	participant := participantIndex(string(service.GetServiceName()))
+	var indices []uint64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", validatorRangesArtifact)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Each line maps a range to the service that runs it, e.g. `0-63: "cl-1-lighthouse-geth"`.
+		scanner := bufio.NewScanner(tarReader)
+		for scanner.Scan() {
+			validatorRange, name, ok := strings.Cut(scanner.Text(), ":")
+			if !ok {
+				continue
+			}
+			name = strings.Trim(strings.TrimSpace(name), `"'`)
+			if participantIndex(name) != participant {
+				continue
+			}
+
+			rangeIndices, err := ParseValidatorRange(validatorRange)
+			if err != nil {
+				return nil, err
+			}
+			indices = append(indices, rangeIndices...)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", header.Name)
+		}
+	}
+
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("no validators found for %s", service.GetServiceName())
+	}
+	return indices, nil
+}
+
+// GetReferenceService returns the service to judge the chain by: the named one, or otherwise the
+// first consensus client that belongs to neither the service under test's participant nor the
+// excluded services, which are shaped or isolated during the test.
+func GetReferenceService(enclaveContext *enclaves.EnclaveContext, service *services.ServiceContext, name string, excluded []*services.ServiceContext) (*services.ServiceContext, error) {
+	if name != "" {
+		reference, err := enclaveContext.GetServiceContext(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get service context for %s", name)
+		}
+		return reference, nil
+	}
+
+	serviceNames, err := enclaveContext.GetServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get services")
+	}
+
+	isExcluded := make(map[string]bool)
+	for _, s := range excluded {
+		isExcluded[string(s.GetServiceName())] = true
+	}
+
+	participant := participantIndex(string(service.GetServiceName()))
+	var best string
+	for serviceName := range serviceNames {
+		candidate := string(serviceName)
+		if !strings.HasPrefix(candidate, "cl-") || isExcluded[candidate] || participantIndex(candidate) == participant {
+			continue
+		}
+		if best == "" || lessByParticipant(candidate, best) {
+			best = candidate
+		}
+	}
+	if best == "" {
+		return nil, fmt.Errorf("no consensus client to use as a reference")
+	}
+
+	reference, err := enclaveContext.GetServiceContext(best)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get service context for %s", best)
+	}
+	return reference, nil
+}